@@ -0,0 +1,26 @@
+-- Migrates a `user` table created before emails were encrypted, see database.FieldEncryptor.
+-- New databases get the final schema from schema.sql and must not run it.
+--
+-- 1. Run this file. email_index stays nullable so existing rows remain valid.
+-- 2. Run `backend-sample reencrypt`: it encrypts the plaintext emails and fills their email_index.
+--    Until then the application reads plaintext emails as they are, but cannot find them by email.
+-- 3. Run 002_user_email_index_not_null.sql once the job reports no failure.
+
+USE `users`;
+
+ALTER TABLE `user`
+    MODIFY email VARCHAR(512) NOT NULL,
+    ADD COLUMN email_index BINARY(32) NULL AFTER email,
+    -- NULL values do not collide, the legacy rows are checked as the job fills their index.
+    ADD UNIQUE KEY user_email_index (email_index);
+
+CREATE TABLE IF NOT EXISTS reencryption_checkpoint
+(
+    job VARCHAR(100) PRIMARY KEY,
+    key_id VARCHAR(100) NOT NULL,
+    last_user_id BINARY(16) NOT NULL,
+    reencrypted BIGINT NOT NULL DEFAULT 0,
+    failed BIGINT NOT NULL DEFAULT 0,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
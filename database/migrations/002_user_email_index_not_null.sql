@@ -0,0 +1,8 @@
+-- Last step of 001_encrypt_user_email.sql, once every email has been encrypted and indexed.
+-- It fails while a row has no email_index: rerun `backend-sample reencrypt -restart` and fix the
+-- rows it reports, duplicate emails among them, first.
+
+USE `users`;
+
+ALTER TABLE `user`
+    MODIFY email_index BINARY(32) NOT NULL;
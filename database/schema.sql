@@ -13,6 +13,21 @@ CREATE TABLE IF NOT EXISTS `user`
 (
     user_id BINARY(16) default (UUID_TO_BIN(UUID())) PRIMARY KEY,
     `name` VARCHAR(100) NOT NULL,
-    email VARCHAR(100) NOT NULL,
+    -- Encrypted by the application, see database.FieldEncryptor.
+    email VARCHAR(512) NOT NULL,
+    -- HMAC-SHA256 of the normalized email, for exact lookups and uniqueness.
+    email_index BINARY(32) NOT NULL,
     password VARCHAR(100) NOT NULL,
-);
\ No newline at end of file
+    UNIQUE KEY user_email_index (email_index)
+);
+-- Progress of the re-encryption jobs, see database.Reencryptor.
+CREATE TABLE IF NOT EXISTS reencryption_checkpoint
+(
+    job VARCHAR(100) PRIMARY KEY,
+    key_id VARCHAR(100) NOT NULL,
+    last_user_id BINARY(16) NOT NULL,
+    reencrypted BIGINT NOT NULL DEFAULT 0,
+    failed BIGINT NOT NULL DEFAULT 0,
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
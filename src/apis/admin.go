@@ -0,0 +1,85 @@
+package apis
+
+import (
+	"backend-sample/common"
+	"backend-sample/database"
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DecodeErrorCodeRequest struct {
+	ErrorCode string `json:"error_code"`
+}
+
+// DecodeErrorCode reveals the identifier, time and request id hidden in an error code sent by a customer
+func DecodeErrorCode(c *gin.Context) {
+	var body DecodeErrorCodeRequest
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.ErrorCode == "" {
+		c.Error(common.NewBackendError(400, "Apis.DecodeErrorCode.1", "invalid payload", err))
+		return
+	}
+
+	keyring, err := common.CurrentErrorCodeKeyring()
+	if err != nil {
+		c.Error(common.NewBackendError(500, "Apis.DecodeErrorCode.2", "error codes are not configured", err))
+		return
+	}
+
+	payload, err := keyring.Decode(body.ErrorCode)
+	if err != nil {
+		c.Error(common.NewBackendError(400, "Apis.DecodeErrorCode.3", "could not decode error code", err))
+		return
+	}
+
+	c.Set("response", payload)
+}
+
+var reencryptor *database.Reencryptor
+
+// InitializeReencryption sets the job run by the re-encryption endpoints
+func InitializeReencryption(job *database.Reencryptor) {
+	reencryptor = job
+}
+
+type StartReencryptionRequest struct {
+	BatchSize int    `json:"batch_size"`
+	Pause     string `json:"pause"`
+	Restart   bool   `json:"restart"`
+}
+
+// StartReencryption starts re-encrypting user columns under the active key in the background
+func StartReencryption(c *gin.Context) {
+	var body StartReencryptionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Error(common.NewBackendError(400, "Apis.StartReencryption.1", "invalid payload", err))
+			return
+		}
+	}
+
+	options := database.ReencryptionOptions{BatchSize: body.BatchSize, Restart: body.Restart}
+	if body.Pause != "" {
+		pause, err := time.ParseDuration(body.Pause)
+		if err != nil {
+			c.Error(common.NewBackendError(400, "Apis.StartReencryption.2", "invalid pause %s", err, body.Pause))
+			return
+		}
+		options.Pause = pause
+	}
+
+	// The job outlives the request, it is stopped on shutdown instead.
+	if berr := reencryptor.Start(context.WithoutCancel(c.Request.Context()), options); berr != nil {
+		c.Error(berr)
+		return
+	}
+
+	c.Set("response", reencryptor.Status())
+}
+
+// GetReencryption reports the progress of the running or last re-encryption
+func GetReencryption(c *gin.Context) {
+	c.Set("response", reencryptor.Status())
+}
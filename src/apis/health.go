@@ -0,0 +1,32 @@
+package apis
+
+import (
+	"backend-sample/health"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var healthRegistry *health.Registry
+
+// InitializeHealth sets the registry whose checkers decide readiness
+func InitializeHealth(registry *health.Registry) {
+	healthRegistry = registry
+}
+
+// Liveness only tells the process is serving requests
+func Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, health.Report{Status: health.StatusUp, Checks: []health.CheckResult{}})
+}
+
+// Readiness reports the status of every registered dependency, with 503 when any is down
+func Readiness(c *gin.Context) {
+	report := healthRegistry.Check(c.Request.Context())
+
+	code := http.StatusOK
+	if report.Status != health.StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+
+	c.JSON(code, report)
+}
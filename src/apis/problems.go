@@ -0,0 +1,23 @@
+package apis
+
+import (
+	"backend-sample/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProblems documents every error identifier the API can return
+func GetProblems(c *gin.Context) {
+	c.Set("response", common.ErrorDefinitions(""))
+}
+
+// GetProblem documents the error identifiers of a problem type, the target of problem type URIs
+func GetProblem(c *gin.Context) {
+	definitions := common.ErrorDefinitions(common.ProblemTypePrefix + c.Param("type"))
+	if len(definitions) == 0 {
+		c.Error(common.NewBackendError(404, "Apis.GetProblem.1", "unknown problem type %s", nil, c.Param("type")))
+		return
+	}
+
+	c.Set("response", definitions)
+}
@@ -1,7 +1,9 @@
 package apis
 
 import (
+	"backend-sample/common"
 	"backend-sample/database"
+	"backend-sample/middlewares"
 	"backend-sample/workflows"
 
 	"github.com/gin-gonic/gin"
@@ -9,10 +11,15 @@ import (
 
 var userWorkflow workflows.UserWorkflowService
 
-// Initialize sets up the necessary services and repositories for APIs
-func Initialize(db database.MySqlDatabaseService) {
+// Initialize sets up the necessary services and repositories for APIs. Users are read through
+// cache unless it is nil, and the lookups by id of a request are batched.
+func Initialize(db *database.MySqlDatabaseService, encryptor *database.FieldEncryptor, cache database.UserCache, cacheConfig database.CacheConfiguration) {
 	// Initialize the repository
-	repository := database.NewRepository(db)
+	repository := database.NewRepository(db, encryptor)
+	if cache != nil {
+		repository = database.NewCachingRepository(repository, cache, cacheConfig)
+	}
+	repository = database.NewBatchingRepository(repository)
 
 	// Initialize the UserWorkflowService with the repository
 	userWorkflow = *workflows.NewUserWorkflow(repository)
@@ -22,7 +29,13 @@ func GetUser(c *gin.Context) {
 	userId, _ := c.GetQuery("user_id")
 	name, _ := c.GetQuery("name")
 
-	response, err := userWorkflow.GetUsers(userId, name)
+	// Lists are streamed, a search may match any number of users.
+	if userId == "" && name != "" {
+		streamUsers(c, name)
+		return
+	}
+
+	response, err := userWorkflow.GetUsers(c.Request.Context(), userId)
 
 	if err != nil {
 		c.Errors = append(c.Errors, c.Error(err))
@@ -36,11 +49,11 @@ func AddUser(c *gin.Context) {
 	var body workflows.UserRequest
 
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(400, gin.H{"error": "invalid payload"})
+		c.Error(common.NewBackendError(400, "Apis.AddUser.1", "invalid payload", err))
 		return
 	}
 
-	response, err := userWorkflow.Create(body)
+	response, err := userWorkflow.Create(c.Request.Context(), body)
 
 	if err != nil {
 		c.Errors = append(c.Errors, c.Error(err))
@@ -54,13 +67,13 @@ func UpdateUser(c *gin.Context) {
 	var body workflows.UserRequest
 
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(400, gin.H{"error": "invalid payload"})
+		c.Error(common.NewBackendError(400, "Apis.UpdateUser.1", "invalid payload", err))
 		return
 	}
 
 	body.Id = c.Param("userId")
 
-	response, err := userWorkflow.Update(body)
+	response, err := userWorkflow.Update(c.Request.Context(), body)
 
 	if err != nil {
 		c.Errors = append(c.Errors, c.Error(err))
@@ -73,7 +86,7 @@ func UpdateUser(c *gin.Context) {
 func DeleteUser(c *gin.Context) {
 	userId := c.Param("userId")
 
-	err := userWorkflow.Delete(userId)
+	err := userWorkflow.Delete(c.Request.Context(), userId)
 
 	if err != nil {
 		c.Errors = append(c.Errors, c.Error(err))
@@ -83,3 +96,22 @@ func DeleteUser(c *gin.Context) {
 	var emptyInterface interface{}
 	c.Set("response", emptyInterface)
 }
+
+// ExportUsers streams every user, or those named like the name query parameter. Ask for
+// application/x-ndjson to get one user per line.
+func ExportUsers(c *gin.Context) {
+	name, _ := c.GetQuery("name")
+	streamUsers(c, name)
+}
+
+func streamUsers(c *gin.Context, name string) {
+	defer middlewares.ExtendForStream(c)()
+
+	users, err := userWorkflow.StreamUsers(c.Request.Context(), name)
+	if err != nil {
+		c.Errors = append(c.Errors, c.Error(err))
+		return
+	}
+
+	middlewares.StreamResponse(c, users)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"backend-sample/common"
+	"backend-sample/config"
+	"backend-sample/database"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]command{
+	"generate-key":      {"print a new random base64 key, e.g. for APP_MASTER_KEY", generateKeyCommand},
+	"encrypt-secret":    {"encrypt a value with APP_MASTER_KEY for use as enc:<value> in the configuration", encryptSecretCommand},
+	"decode-error-code": {"decode an error code returned to a client with the configured error code keys", decodeErrorCodeCommand},
+	"reencrypt":         {"re-encrypt user columns under the active field encryption key, resuming from the last checkpoint", reencryptCommand},
+}
+
+// runCommand runs the subcommand named by args[0], if any, and reports whether it did.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+
+	if err := cmd.run(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+
+	return true
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-20s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "\nWithout a command the server is started with these flags:\n")
+	flag.PrintDefaults()
+}
+
+func generateKeyCommand(args []string) error {
+	key, err := common.GenerateAESKey(32)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(common.EncodeBase64(key))
+	return nil
+}
+
+func encryptSecretCommand(args []string) error {
+	flags := flag.NewFlagSet("encrypt-secret", flag.ContinueOnError)
+	value := flags.String("value", "", "value to encrypt, read from stdin when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	masterKey, err := config.MasterKeyFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	plaintext := *value
+	if plaintext == "" {
+		plaintext, err = readValue(os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+
+	encrypted, err := config.EncryptSecret(masterKey, plaintext)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(encrypted)
+	return nil
+}
+
+func decodeErrorCodeCommand(args []string) error {
+	flags := flag.NewFlagSet("decode-error-code", flag.ContinueOnError)
+	code := flags.String("code", "", "error code to decode, read from stdin when empty")
+	options := config.RegisterFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	configuration, err := config.Load(*options)
+	if err != nil {
+		return err
+	}
+
+	keyring, err := common.NewErrorCodeKeyring(configuration.ErrorCodes)
+	if err != nil {
+		return err
+	}
+
+	errorCode := *code
+	if errorCode == "" {
+		errorCode, err = readValue(os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+
+	payload, err := keyring.Decode(errorCode)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(payload)
+}
+
+func reencryptCommand(args []string) error {
+	flags := flag.NewFlagSet("reencrypt", flag.ContinueOnError)
+	batchSize := flags.Int("batch-size", database.DefaultReencryptionBatchSize, "rows re-encrypted per batch")
+	pause := flags.Duration("pause", database.DefaultReencryptionPause, "pause between batches, negative to disable")
+	restart := flags.Bool("restart", false, "ignore the checkpoint and walk the whole table again")
+	options := config.RegisterFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	configuration, err := config.Load(*options)
+	if err != nil {
+		return err
+	}
+
+	logger, err := common.NewLogger(configuration.Logging, os.Stderr)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	if err := common.ConfigureEncryption(configuration.Encryption); err != nil {
+		return err
+	}
+	encryptor, err := database.NewFieldEncryptor(configuration.FieldEncryption)
+	if err != nil {
+		return err
+	}
+
+	db, berr := database.NewMySqlDatabaseService(configuration.Database)
+	if berr != nil {
+		return berr
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, berr := database.NewReencryptor(db, encryptor).Run(ctx, database.ReencryptionOptions{BatchSize: *batchSize, Pause: *pause, Restart: *restart})
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	if berr != nil {
+		return berr
+	}
+	return nil
+}
+
+func readValue(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("no value provided")
+	}
+
+	return line, nil
+}
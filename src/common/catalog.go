@@ -0,0 +1,155 @@
+package common
+
+import (
+	"sort"
+	"strings"
+)
+
+// ProblemTypePrefix starts the type URI of every problem. The URIs resolve to their documentation.
+const ProblemTypePrefix = "/problems/"
+
+// ProblemType is a kind of problem reported to clients, shared by errors with the same meaning.
+type ProblemType struct {
+	Type   string `json:"type" yaml:"type"`
+	Title  string `json:"title" yaml:"title"`
+	Status int    `json:"status" yaml:"status"`
+}
+
+// ErrorDefinition documents a BackendError identifier.
+type ErrorDefinition struct {
+	Identifier    string `json:"identifier" yaml:"identifier"`
+	ProblemType   `yaml:",inline"`
+	Documentation string `json:"documentation" yaml:"documentation"`
+}
+
+var (
+	ProblemInvalidRequest      = newProblemType("invalid-request", "Invalid request", 400)
+	ProblemInvalidUserId       = newProblemType("invalid-user-id", "Invalid user id", 400)
+	ProblemInvalidName         = newProblemType("invalid-name", "Invalid name", 400)
+	ProblemInvalidErrorCode    = newProblemType("invalid-error-code", "Invalid error code", 400)
+	ProblemValidationFailed    = newProblemType("validation-failed", "Validation failed", 422)
+	ProblemNotFound            = newProblemType("not-found", "Not found", 404)
+	ProblemUserNotFound        = newProblemType("user-not-found", "User not found", 404)
+	ProblemJobRunning          = newProblemType("job-already-running", "Job already running", 409)
+	ProblemInternal            = newProblemType("internal-error", "Internal error", 500)
+	ProblemEmailTaken          = newProblemType("email-already-registered", "Email already registered", 409)
+	ProblemConflict            = newProblemType("conflict", "Conflict", 409)
+	ProblemDatabaseBusy        = newProblemType("database-busy", "Database busy", 503)
+	ProblemDatabaseUnavailable = newProblemType("database-unavailable", "Database unavailable", 503)
+	ProblemOverloaded          = newProblemType("server-overloaded", "Server overloaded", 503)
+	ProblemRequestCanceled     = newProblemType("request-canceled", "Request canceled", 499)
+	ProblemTimeout             = newProblemType("timeout", "Request timed out", 504)
+)
+
+// errorCatalog lists every identifier passed to NewBackendError. Identifiers are never reused
+// for another error, as clients and error codes already sent out refer to them.
+var errorCatalog = buildErrorCatalog(
+	// apis
+	define(ProblemInvalidRequest, "Apis.DecodeErrorCode.1", "The body must be a JSON object with a non empty error_code."),
+	define(ProblemInternal, "Apis.DecodeErrorCode.2", "No error code keys are configured, see errorCodes in the configuration."),
+	define(ProblemInvalidErrorCode, "Apis.DecodeErrorCode.3", "The error code is malformed, tampered with or encrypted with a key no longer configured."),
+	define(ProblemInvalidRequest, "Apis.AddUser.1", "The body must be a JSON object with name, email and password."),
+	define(ProblemInvalidRequest, "Apis.UpdateUser.1", "The body must be a JSON object with the name, email and password to change."),
+	define(ProblemInvalidRequest, "Apis.StartReencryption.1", "The body must be empty or a JSON object with batch_size, pause and restart."),
+	define(ProblemInvalidRequest, "Apis.StartReencryption.2", "pause must be a duration with a unit, e.g. 250ms."),
+	define(ProblemNotFound, "Apis.GetProblem.1", "No problem type has this name, GET /problems lists them all."),
+
+	// middlewares
+	define(ProblemOverloaded, "Middlewares.ConcurrencyLimit.1", "Too many requests are in progress, try again after Retry-After."),
+
+	// workflows
+	define(ProblemValidationFailed, "Workflows.CreateUser.5", "One or more fields of the user are invalid, violations lists every one of them."),
+	define(ProblemValidationFailed, "Workflows.UpdateUser.7", "One or more fields of the user are invalid, violations lists every one of them."),
+	define(ProblemInvalidUserId, "Workflows.DeleteUser.1", "The user id must be a UUID."),
+	define(ProblemInvalidUserId, "Workflows.getUserById.1", "The user_id query parameter must be a UUID."),
+	define(ProblemInvalidName, "Workflows.StreamUsers.1", "The name query parameter must have between 1 and 100 characters."),
+
+	// database
+	define(ProblemDatabaseUnavailable, "GetConnection.1", "The database section of the configuration is missing."),
+	define(ProblemDatabaseUnavailable, "NewMySqlDatabaseService.1", "The database section of the configuration is missing."),
+	define(ProblemDatabaseUnavailable, "NewMySqlDatabaseService.2", "The connection pool of the primary could not be created from the configuration."),
+	define(ProblemDatabaseUnavailable, "NewMySqlDatabaseService.3", "The connection pool of a replica could not be created from the configuration."),
+	define(ProblemEmailTaken, "ClassifyError.1", "Another user already registered this email, compared ignoring case and surrounding spaces."),
+	define(ProblemConflict, "ClassifyError.2", "The value conflicts with a row already stored under a unique key."),
+	define(ProblemInvalidRequest, "ClassifyError.3", "A value is longer than its column allows."),
+	define(ProblemDatabaseBusy, "ClassifyError.4", "The query hit a deadlock or timed out waiting for a lock, it can be retried."),
+	define(ProblemDatabaseUnavailable, "ClassifyError.5", "The database refused or lost the connection, it can be retried once it is back."),
+	define(ProblemDatabaseUnavailable, "ClassifyError.6", "The database failed repeatedly, queries fail fast until Retry-After elapses."),
+	define(ProblemRequestCanceled, "ClassifyError.7", "The client closed the request before the query finished, nothing was sent back."),
+	define(ProblemTimeout, "ClassifyError.8", "The query did not finish before the deadline of the route, see timeouts in the configuration."),
+	define(ProblemInternal, "CreateUser.1", "A user id could not be generated."),
+	define(ProblemInternal, "CreateUser.2", "The user could not be inserted."),
+	define(ProblemInternal, "CreateUser.3", "The user was not found right after being inserted."),
+	define(ProblemInternal, "CreateUser.4", "The email could not be encrypted, check fieldEncryption in the configuration."),
+	define(ProblemInternal, "UpdateUser.1", "The user id could not be converted for the query."),
+	define(ProblemInternal, "UpdateUser.2", "The user could not be updated."),
+	define(ProblemInternal, "UpdateUser.3", "The number of updated rows could not be read."),
+	define(ProblemInternal, "UpdateUser.4", "The email could not be encrypted, check fieldEncryption in the configuration."),
+	define(ProblemInternal, "GetUserByName.1", "Users could not be queried by name."),
+	define(ProblemInternal, "GetUserByName.2", "A user row could not be read."),
+	define(ProblemInternal, "GetUserByName.3", "A stored user id is not a valid UUID."),
+	define(ProblemInternal, "GetUserByName.4", "A stored email could not be decrypted, its key may no longer be configured."),
+	define(ProblemInternal, "GetUserByName.5", "The query of the searched name could not be built."),
+	define(ProblemInternal, "GetUserById.1", "The user id could not be converted for the query."),
+	define(ProblemInternal, "GetUserById.2", "The user could not be queried."),
+	define(ProblemUserNotFound, "GetUserById.3", "No user has this id, it may have been deleted."),
+	define(ProblemInternal, "GetUserById.4", "The user row could not be read."),
+	define(ProblemInternal, "GetUserById.5", "The stored user id is not a valid UUID."),
+	define(ProblemInternal, "GetUserById.6", "The stored email could not be decrypted, its key may no longer be configured."),
+	define(ProblemInternal, "GetUsers.1", "Users could not be queried."),
+	define(ProblemInternal, "GetUsers.2", "A stored user id is not a valid UUID."),
+	define(ProblemInternal, "GetUsers.3", "A user row could not be read."),
+	define(ProblemInternal, "GetUsers.4", "A stored email could not be decrypted, its key may no longer be configured."),
+	define(ProblemInternal, "GetUsers.5", "The blind index of the searched email could not be computed."),
+	define(ProblemInternal, "GetUsers.6", "A searched user id could not be converted for the query."),
+	define(ProblemInternal, "GetUsers.7", "The query of the searched users could not be built."),
+	define(ProblemInternal, "DeleteUser.1", "The user id could not be converted for the query."),
+	define(ProblemInternal, "DeleteUser.2", "The user could not be deleted."),
+	define(ProblemInternal, "DeleteUser.3", "The number of deleted rows could not be read."),
+	define(ProblemJobRunning, "Reencrypt.1", "A re-encryption is already running, follow it with GET /admin/reencryption."),
+	define(ProblemInternal, "Reencrypt.2", "The re-encryption was stopped, running it again resumes from its checkpoint."),
+	define(ProblemInternal, "Reencrypt.3", "A batch of users could not be read."),
+	define(ProblemInternal, "Reencrypt.4", "A user row could not be read."),
+	define(ProblemInternal, "Reencrypt.5", "The re-encryption checkpoint could not be read."),
+	define(ProblemInternal, "Reencrypt.6", "The re-encryption checkpoint could not be saved."),
+)
+
+func newProblemType(name, title string, status int) ProblemType {
+	return ProblemType{Type: ProblemTypePrefix + name, Title: title, Status: status}
+}
+
+func define(problem ProblemType, identifier, documentation string) ErrorDefinition {
+	return ErrorDefinition{Identifier: identifier, ProblemType: problem, Documentation: documentation}
+}
+
+func buildErrorCatalog(definitions ...ErrorDefinition) map[string]ErrorDefinition {
+	catalog := make(map[string]ErrorDefinition, len(definitions))
+	for _, definition := range definitions {
+		if _, ok := catalog[definition.Identifier]; ok {
+			panic("duplicated error identifier " + definition.Identifier)
+		}
+		catalog[definition.Identifier] = definition
+	}
+	return catalog
+}
+
+// LookupError returns the definition of a BackendError identifier.
+func LookupError(identifier string) (ErrorDefinition, bool) {
+	definition, ok := errorCatalog[identifier]
+	return definition, ok
+}
+
+// ErrorDefinitions returns the definitions of a problem type, or all of them when problemType is
+// empty, sorted by identifier.
+func ErrorDefinitions(problemType string) []ErrorDefinition {
+	definitions := make([]ErrorDefinition, 0)
+	for _, definition := range errorCatalog {
+		if problemType == "" || definition.Type == problemType {
+			definitions = append(definitions, definition)
+		}
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		return strings.Compare(definitions[i].Identifier, definitions[j].Identifier) < 0
+	})
+	return definitions
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Test_ErrorCatalog_CoversEveryIdentifier parses the module and checks every identifier given to
+// NewBackendError is in the catalog with the same status, and every catalog entry is still used.
+func Test_ErrorCatalog_CoversEveryIdentifier(t *testing.T) {
+	used := make(map[string]bool)
+	fset := token.NewFileSet()
+	err := filepath.WalkDir("..", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return err
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+
+		ast.Inspect(file, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok || !isNewBackendError(call.Fun) || len(call.Args) < 2 {
+				return true
+			}
+
+			position := fset.Position(call.Pos())
+			literal, ok := call.Args[1].(*ast.BasicLit)
+			if !ok || literal.Kind != token.STRING {
+				t.Errorf("%s: the identifier must be a string literal to be checked against the catalog", position)
+				return true
+			}
+
+			identifier, _ := strconv.Unquote(literal.Value)
+			used[identifier] = true
+			definition, ok := LookupError(identifier)
+			if !ok {
+				t.Errorf("%s: identifier %s is not registered in the error catalog", position, identifier)
+				return true
+			}
+
+			if status, ok := call.Args[0].(*ast.BasicLit); ok && status.Kind == token.INT && status.Value != strconv.Itoa(definition.Status) {
+				t.Errorf("%s: identifier %s is created with status %s but cataloged with %d", position, identifier, status.Value, definition.Status)
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("could not parse the module: %v", err)
+	}
+
+	for _, definition := range ErrorDefinitions("") {
+		if !used[definition.Identifier] {
+			t.Errorf("identifier %s is cataloged but never created", definition.Identifier)
+		}
+	}
+}
+
+// Test_ErrorCatalog_ApisReportErrorsAsProblems checks the handlers do not write error responses
+// themselves, which would bypass the catalog, problem details and localization.
+func Test_ErrorCatalog_ApisReportErrorsAsProblems(t *testing.T) {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, "../apis", nil, 0)
+	if err != nil {
+		t.Fatalf("could not parse the apis: %v", err)
+	}
+
+	for _, pkg := range packages {
+		ast.Inspect(pkg, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			selector, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || (selector.Sel.Name != "JSON" && selector.Sel.Name != "AbortWithStatusJSON") {
+				return true
+			}
+			status, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || status.Kind != token.INT {
+				return true
+			}
+			if code, _ := strconv.Atoi(status.Value); code >= 400 {
+				t.Errorf("%s: error responses must be BackendErrors given to c.Error", fset.Position(call.Pos()))
+			}
+			return true
+		})
+	}
+}
+
+func isNewBackendError(fun ast.Expr) bool {
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		return fun.Name == "NewBackendError"
+	case *ast.SelectorExpr:
+		return fun.Sel.Name == "NewBackendError"
+	}
+	return false
+}
+
+func Test_ErrorDefinitions_FiltersByType(t *testing.T) {
+	definitions := ErrorDefinitions(ProblemUserNotFound.Type)
+
+	if len(definitions) != 1 || definitions[0].Identifier != "GetUserById.3" || definitions[0].Status != 404 {
+		t.Errorf("unexpected definitions %+v", definitions)
+	}
+}
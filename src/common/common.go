@@ -29,15 +29,13 @@ func UuidToBinary(uuid uuid.UUID) ([]byte, error) {
 }
 
 func BinaryToUuid(bytes []byte) (uuid.UUID, error) {
-	var binary []byte
-	nbOfBytes := hex.Encode(binary, bytes)
-	if nbOfBytes == 0 {
+	if len(bytes) != 16 {
 		return uuid.Nil, errBinaryToUuidInvalidBytes
 	}
 
-	id, err := uuid.ParseBytes(binary)
+	id, err := uuid.FromBytes(bytes)
 
-	if err != nil {
+	if err != nil || id == uuid.Nil {
 		return uuid.Nil, errBinaryToUuidCouldNotParse
 	}
 
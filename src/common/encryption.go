@@ -5,10 +5,98 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
+// Algorithm identifies the AEAD used to seal an envelope. Its value is stored in the envelope header.
+type Algorithm byte
+
+const (
+	AlgorithmAES256GCM         Algorithm = 1
+	AlgorithmXChaCha20Poly1305 Algorithm = 2
+)
+
+// KeySize is the size in bytes of the keys used by every supported algorithm.
+const KeySize = 32
+
+// EnvelopePrefix marks encrypted strings using the envelope format. Legacy CFB values are
+// plain URL base64, which never contains ':'.
+const EnvelopePrefix = "aead:"
+
+// Envelope versions, the first byte of every envelope. They are never renumbered, sealed data
+// keeps its version.
+const (
+	envelopeVersion1 byte = 1
+	// streamVersionSharedKey seals every stream with the key itself. It is only read.
+	streamVersionSharedKey byte = 2
+	// streamVersionDerivedKey seals each stream with its own key, derived from the key and a random salt.
+	streamVersionDerivedKey byte = 3
+)
+
+const envelopeHeaderSize = 2
+
+var (
+	errUnknownAlgorithm       = errors.New("unknown encryption algorithm")
+	errInvalidKeySize         = fmt.Errorf("encryption key must be %d bytes", KeySize)
+	errEnvelopeTooShort       = errors.New("envelope too short")
+	errUnknownEnvelopeVersion = errors.New("unknown envelope version")
+	errDecryptionFailed       = errors.New("message authentication failed")
+	errLegacyDecryptionOff    = errors.New("legacy CFB ciphertexts are no longer accepted")
+)
+
+type EncryptionConfiguration struct {
+	Algorithm      string `json:"algorithm" yaml:"algorithm"`
+	AllowLegacyCFB bool   `json:"allowLegacyCFB" yaml:"allowLegacyCFB"`
+}
+
+var (
+	defaultAlgorithm atomic.Uint32
+	allowLegacyCFB   atomic.Bool
+)
+
+func init() {
+	defaultAlgorithm.Store(uint32(AlgorithmAES256GCM))
+}
+
+// ConfigureEncryption sets the algorithm used by Encrypt and whether Decrypt still accepts legacy CFB values.
+func ConfigureEncryption(config EncryptionConfiguration) error {
+	algorithm, err := ParseAlgorithm(config.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	defaultAlgorithm.Store(uint32(algorithm))
+	allowLegacyCFB.Store(config.AllowLegacyCFB)
+	return nil
+}
+
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "", "aes-256-gcm":
+		return AlgorithmAES256GCM, nil
+	case "xchacha20-poly1305":
+		return AlgorithmXChaCha20Poly1305, nil
+	default:
+		return 0, fmt.Errorf("%w %s", errUnknownAlgorithm, name)
+	}
+}
+
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmAES256GCM:
+		return "aes-256-gcm"
+	case AlgorithmXChaCha20Poly1305:
+		return "xchacha20-poly1305"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(a))
+	}
+}
+
 // GenerateAESKey generates a random AES key of the specified size (in bytes).
 func GenerateAESKey(size int) ([]byte, error) {
 	key := make([]byte, size)
@@ -19,28 +107,113 @@ func GenerateAESKey(size int) ([]byte, error) {
 	return key, nil
 }
 
-// Encrypt the input string
-func EncryptAES(key []byte, plaintext string) (string, error) {
-	block, err := aes.NewCipher(key)
+func newAEAD(algorithm Algorithm, key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errInvalidKeySize
+	}
+
+	switch algorithm {
+	case AlgorithmAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AlgorithmXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, errUnknownAlgorithm
+	}
+}
+
+// Seal encrypts and authenticates plaintext and associatedData. The envelope is
+// version | algorithm | nonce | ciphertext and tag.
+func Seal(algorithm Algorithm, key, plaintext, associatedData []byte) ([]byte, error) {
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope := make([]byte, envelopeHeaderSize+aead.NonceSize(), envelopeHeaderSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	envelope[0], envelope[1] = envelopeVersion1, byte(algorithm)
+	nonce := envelope[envelopeHeaderSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(envelope, nonce, plaintext, associatedData), nil
+}
+
+// Open decrypts an envelope produced by Seal, failing when it or associatedData were tampered with.
+func Open(key, envelope, associatedData []byte) ([]byte, error) {
+	if len(envelope) < envelopeHeaderSize {
+		return nil, errEnvelopeTooShort
+	}
+	if envelope[0] != envelopeVersion1 {
+		return nil, errUnknownEnvelopeVersion
+	}
+
+	aead, err := newAEAD(Algorithm(envelope[1]), key)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope = envelope[envelopeHeaderSize:]
+	if len(envelope) < aead.NonceSize()+aead.Overhead() {
+		return nil, errEnvelopeTooShort
+	}
+
+	plaintext, err := aead.Open(nil, envelope[:aead.NonceSize()], envelope[aead.NonceSize():], associatedData)
+	if err != nil {
+		return nil, errDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// Encrypt seals plaintext with the configured algorithm and returns it as a printable envelope.
+func Encrypt(key []byte, plaintext string, associatedData []byte) (string, error) {
+	return EncryptWith(Algorithm(defaultAlgorithm.Load()), key, plaintext, associatedData)
+}
+
+func EncryptWith(algorithm Algorithm, key []byte, plaintext string, associatedData []byte) (string, error) {
+	envelope, err := Seal(algorithm, key, []byte(plaintext), associatedData)
 	if err != nil {
 		return "", err
 	}
+	return EnvelopePrefix + base64.RawURLEncoding.EncodeToString(envelope), nil
+}
+
+// Decrypt opens a value produced by Encrypt. While legacy decryption is allowed, values
+// encrypted with the former AES-CFB scheme are accepted too, without associated data.
+func Decrypt(key []byte, value string, associatedData []byte) (string, error) {
+	encoded, ok := strings.CutPrefix(value, EnvelopePrefix)
+	if !ok {
+		if !allowLegacyCFB.Load() {
+			return "", errLegacyDecryptionOff
+		}
+		return decryptLegacyCFB(key, value)
+	}
 
-	// Generate a random IV
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	envelope, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
 		return "", err
 	}
 
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], []byte(plaintext))
+	plaintext, err := Open(key, envelope, associatedData)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
 
-	return base64.URLEncoding.EncodeToString(ciphertext), nil
+// IsLegacyCiphertext reports whether value was encrypted with the former AES-CFB scheme and should be re-encrypted.
+func IsLegacyCiphertext(value string) bool {
+	return value != "" && !strings.HasPrefix(value, EnvelopePrefix)
 }
 
-// Decrypt the encrypted string
-func DecryptAES(key []byte, ciphertext string) (string, error) {
+// decryptLegacyCFB decrypts values written before envelopes existed. CFB is not
+// authenticated, so a tampered value decrypts to garbage instead of failing.
+func decryptLegacyCFB(key []byte, ciphertext string) (string, error) {
 	ciphertextBytes, err := base64.URLEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
@@ -0,0 +1,242 @@
+package common
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// StreamSegmentSize is the plaintext size of each segment sealed by NewEncryptWriter.
+const StreamSegmentSize = 64 * 1024
+
+// Each segment nonce is the random stream prefix, a 4 byte counter and a flag set on the last segment,
+// so reordered, dropped or truncated segments fail authentication.
+const streamNonceSuffixSize = 5
+
+// streamSaltSize is the size of the random salt each stream key is derived with. The nonce prefix of
+// AES-GCM is only 7 bytes, too few to stay unique across every stream sealed with a long-lived key,
+// so each stream gets its own key instead.
+const streamSaltSize = 32
+
+var (
+	errStreamTruncated = errors.New("encrypted stream is truncated")
+	errStreamTooLong   = errors.New("encrypted stream has too many segments")
+	errStreamClosed    = errors.New("encrypted stream is closed")
+)
+
+type streamCipher struct {
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint32
+	ad      []byte
+}
+
+func (s *streamCipher) next(last bool) ([]byte, error) {
+	if s.counter == math.MaxUint32 {
+		return nil, errStreamTooLong
+	}
+
+	prefixSize := len(s.nonce) - streamNonceSuffixSize
+	binary.BigEndian.PutUint32(s.nonce[prefixSize:], s.counter)
+	s.nonce[len(s.nonce)-1] = 0
+	if last {
+		s.nonce[len(s.nonce)-1] = 1
+	}
+	s.counter++
+	return s.nonce, nil
+}
+
+type encryptWriter struct {
+	streamCipher
+	w      io.Writer
+	buffer []byte
+	closed bool
+}
+
+// NewEncryptWriter returns a writer sealing everything written to it into w in segments of
+// StreamSegmentSize bytes. Close must be called to write the last segment.
+func NewEncryptWriter(w io.Writer, algorithm Algorithm, key, associatedData []byte) (io.WriteCloser, error) {
+	salt := make([]byte, streamSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newStreamAEAD(algorithm, key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce[:len(nonce)-streamNonceSuffixSize]); err != nil {
+		return nil, err
+	}
+
+	header := append([]byte{streamVersionDerivedKey, byte(algorithm)}, salt...)
+	header = append(header, nonce[:len(nonce)-streamNonceSuffixSize]...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		streamCipher: streamCipher{aead: aead, nonce: nonce, ad: associatedData},
+		w:            w,
+		buffer:       make([]byte, 0, StreamSegmentSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errStreamClosed
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full segment is only flushed once more data arrives, as the last one must be flagged.
+		if len(e.buffer) == StreamSegmentSize {
+			if err := e.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buffer[len(e.buffer):StreamSegmentSize], p)
+		e.buffer = e.buffer[:len(e.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	nonce, err := e.next(last)
+	if err != nil {
+		return err
+	}
+
+	segment := e.aead.Seal(nil, nonce, e.buffer, e.ad)
+	e.buffer = e.buffer[:0]
+	_, err = e.w.Write(segment)
+	return err
+}
+
+type decryptReader struct {
+	streamCipher
+	r         *bufio.Reader
+	segment   []byte
+	plaintext []byte
+	done      bool
+}
+
+// NewDecryptReader returns a reader of the plaintext sealed by NewEncryptWriter into r. Reads
+// fail as soon as a segment does not authenticate or the stream ends before its last segment.
+func NewDecryptReader(r io.Reader, key, associatedData []byte) (io.Reader, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, envelopeHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, errEnvelopeTooShort
+	}
+
+	var aead cipher.AEAD
+	var err error
+	switch header[0] {
+	case streamVersionSharedKey:
+		// Streams sealed before each had its own key.
+		aead, err = newAEAD(Algorithm(header[1]), key)
+	case streamVersionDerivedKey:
+		salt := make([]byte, streamSaltSize)
+		if _, err := io.ReadFull(reader, salt); err != nil {
+			return nil, errEnvelopeTooShort
+		}
+		aead, err = newStreamAEAD(Algorithm(header[1]), key, salt)
+	default:
+		return nil, errUnknownEnvelopeVersion
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(reader, nonce[:len(nonce)-streamNonceSuffixSize]); err != nil {
+		return nil, errEnvelopeTooShort
+	}
+
+	return &decryptReader{
+		streamCipher: streamCipher{aead: aead, nonce: nonce, ad: associatedData},
+		r:            reader,
+		segment:      make([]byte, StreamSegmentSize+aead.Overhead()),
+	}, nil
+}
+
+// newStreamAEAD returns the AEAD of a stream, keyed with HKDF-SHA256 of key, salt and algorithm.
+func newStreamAEAD(algorithm Algorithm, key, salt []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errInvalidKeySize
+	}
+
+	streamKey := make([]byte, KeySize)
+	info := append([]byte("stream/"), byte(algorithm))
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, info), streamKey); err != nil {
+		return nil, err
+	}
+	return newAEAD(algorithm, streamKey)
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plaintext) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.readSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plaintext)
+	d.plaintext = d.plaintext[n:]
+	return n, nil
+}
+
+func (d *decryptReader) readSegment() error {
+	n, err := io.ReadFull(d.r, d.segment)
+	last := false
+	switch {
+	case err == nil:
+		if _, err := d.r.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case errors.Is(err, io.EOF):
+		return errStreamTruncated
+	default:
+		return err
+	}
+
+	nonce, err := d.next(last)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := d.aead.Open(d.segment[:0], nonce, d.segment[:n], d.ad)
+	if err != nil {
+		return errDecryptionFailed
+	}
+
+	d.plaintext = plaintext
+	d.done = last
+	return nil
+}
@@ -0,0 +1,130 @@
+package common
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encryptStream(t *testing.T, algorithm Algorithm, key, plaintext []byte) []byte {
+	t.Helper()
+	var sealed bytes.Buffer
+	writer, err := NewEncryptWriter(&sealed, algorithm, key, []byte("export"))
+	if err != nil {
+		t.Fatalf("NewEncryptWriter returned an error: %v", err)
+	}
+	// Uneven writes make segments span several calls.
+	for chunk := plaintext; len(chunk) > 0; {
+		n := min(len(chunk), 1000)
+		if _, err := writer.Write(chunk[:n]); err != nil {
+			t.Fatalf("Write returned an error: %v", err)
+		}
+		chunk = chunk[n:]
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	return sealed.Bytes()
+}
+
+func decryptStream(key, sealed []byte) ([]byte, error) {
+	reader, err := NewDecryptReader(bytes.NewReader(sealed), key, []byte("export"))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func Test_EncryptWriter_DecryptReader_ExpectPlaintext(t *testing.T) {
+	key := newTestKey(t)
+	for _, size := range []int{0, 10, StreamSegmentSize, 3*StreamSegmentSize + 7} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+		for _, algorithm := range []Algorithm{AlgorithmAES256GCM, AlgorithmXChaCha20Poly1305} {
+			decrypted, err := decryptStream(key, encryptStream(t, algorithm, key, plaintext))
+			if err != nil {
+				t.Fatalf("%s of %d bytes: decrypt returned an error: %v", algorithm, size, err)
+			}
+			if !bytes.Equal(plaintext, decrypted) {
+				t.Errorf("%s of %d bytes: decrypted plaintext differs", algorithm, size)
+			}
+		}
+	}
+}
+
+func Test_DecryptReader_TruncatedOrTampered_ExpectError(t *testing.T) {
+	key := newTestKey(t)
+	plaintext := make([]byte, 2*StreamSegmentSize+100)
+	sealed := encryptStream(t, AlgorithmAES256GCM, key, plaintext)
+	segmentSize := StreamSegmentSize + 16
+	headerSize := envelopeHeaderSize + streamSaltSize + 12 - streamNonceSuffixSize
+
+	// Dropping the last segment leaves a full segment that is not flagged as last.
+	if _, err := decryptStream(key, sealed[:headerSize+2*segmentSize]); !errors.Is(err, errDecryptionFailed) {
+		t.Errorf("decrypt of a stream without its last segment returned %v", err)
+	}
+	if _, err := decryptStream(key, sealed[:headerSize]); !errors.Is(err, errStreamTruncated) {
+		t.Errorf("decrypt of a stream without segments returned %v", err)
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[headerSize+segmentSize+1] ^= 1
+	if _, err := decryptStream(key, tampered); !errors.Is(err, errDecryptionFailed) {
+		t.Errorf("decrypt of a tampered stream returned %v", err)
+	}
+
+	reordered := append([]byte{}, sealed[:headerSize]...)
+	reordered = append(reordered, sealed[headerSize+segmentSize:headerSize+2*segmentSize]...)
+	reordered = append(reordered, sealed[headerSize:headerSize+segmentSize]...)
+	reordered = append(reordered, sealed[headerSize+2*segmentSize:]...)
+	if _, err := decryptStream(key, reordered); !errors.Is(err, errDecryptionFailed) {
+		t.Errorf("decrypt of a reordered stream returned %v", err)
+	}
+}
+
+func Test_EncryptWriter_SameKey_ExpectEachStreamKeyed(t *testing.T) {
+	key := newTestKey(t)
+	plaintext := make([]byte, 100)
+	first := encryptStream(t, AlgorithmAES256GCM, key, plaintext)
+	second := encryptStream(t, AlgorithmAES256GCM, key, plaintext)
+
+	saltOf := func(sealed []byte) []byte { return sealed[envelopeHeaderSize : envelopeHeaderSize+streamSaltSize] }
+	if bytes.Equal(saltOf(first), saltOf(second)) {
+		t.Fatal("both streams have the same salt")
+	}
+
+	// Sealing a segment with each stream key under the same nonce must give different ciphertexts.
+	nonce := make([]byte, 12)
+	var sealed [][]byte
+	for _, stream := range [][]byte{first, second} {
+		aead, err := newStreamAEAD(AlgorithmAES256GCM, key, saltOf(stream))
+		if err != nil {
+			t.Fatalf("newStreamAEAD returned an error: %v", err)
+		}
+		sealed = append(sealed, aead.Seal(nil, nonce, plaintext, nil))
+	}
+	if bytes.Equal(sealed[0], sealed[1]) {
+		t.Error("both streams are sealed with the same key")
+	}
+}
+
+func Test_DecryptReader_SharedKeyStream_ExpectPlaintext(t *testing.T) {
+	key := newTestKey(t)
+	aead, err := newAEAD(AlgorithmAES256GCM, key)
+	if err != nil {
+		t.Fatalf("newAEAD returned an error: %v", err)
+	}
+
+	// A stream of a single segment, sealed with key itself: a zero nonce prefix, counter 0, last flag set.
+	nonce := make([]byte, aead.NonceSize())
+	nonce[len(nonce)-1] = 1
+	sealed := append([]byte{streamVersionSharedKey, byte(AlgorithmAES256GCM)}, nonce[:len(nonce)-streamNonceSuffixSize]...)
+	sealed = aead.Seal(sealed, nonce, []byte("legacy export"), []byte("export"))
+
+	decrypted, err := decryptStream(key, sealed)
+	if err != nil || string(decrypted) != "legacy export" {
+		t.Errorf("decrypt of a shared key stream returned %q, %v", decrypted, err)
+	}
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// encryptLegacyCFB reproduces the former EncryptAES to check values written before envelopes.
+func encryptLegacyCFB(t *testing.T, key []byte, plaintext string) string {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher returned an error: %v", err)
+	}
+
+	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
+	iv := ciphertext[:aes.BlockSize]
+	rand.Read(iv)
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(ciphertext[aes.BlockSize:], []byte(plaintext))
+
+	return base64.URLEncoding.EncodeToString(ciphertext)
+}
+
+func newTestKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := GenerateAESKey(KeySize)
+	if err != nil {
+		t.Fatalf("GenerateAESKey returned an error: %v", err)
+	}
+	return key
+}
+
+func Test_EncryptWith_Decrypt_ExpectPlaintext(t *testing.T) {
+	key := newTestKey(t)
+	for _, algorithm := range []Algorithm{AlgorithmAES256GCM, AlgorithmXChaCha20Poly1305} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			encrypted, err := EncryptWith(algorithm, key, "john@example.com", []byte("users.email"))
+			if err != nil {
+				t.Fatalf("EncryptWith returned an error: %v", err)
+			}
+			if !strings.HasPrefix(encrypted, EnvelopePrefix) || IsLegacyCiphertext(encrypted) {
+				t.Errorf("EncryptWith returned %s without the envelope prefix", encrypted)
+			}
+
+			decrypted, err := Decrypt(key, encrypted, []byte("users.email"))
+			if err != nil {
+				t.Fatalf("Decrypt returned an error: %v", err)
+			}
+			if decrypted != "john@example.com" {
+				t.Errorf("Decrypt returned %s", decrypted)
+			}
+		})
+	}
+}
+
+func Test_Open_Tampered_ExpectError(t *testing.T) {
+	key := newTestKey(t)
+	envelope, err := Seal(AlgorithmAES256GCM, key, []byte("secret"), []byte("ad"))
+	if err != nil {
+		t.Fatalf("Seal returned an error: %v", err)
+	}
+
+	tampered := append([]byte{}, envelope...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := Open(key, tampered, []byte("ad")); !errors.Is(err, errDecryptionFailed) {
+		t.Errorf("Open of a tampered envelope returned %v", err)
+	}
+	if _, err := Open(key, envelope, []byte("other")); !errors.Is(err, errDecryptionFailed) {
+		t.Errorf("Open with other associated data returned %v", err)
+	}
+	if _, err := Open(newTestKey(t), envelope, []byte("ad")); !errors.Is(err, errDecryptionFailed) {
+		t.Errorf("Open with another key returned %v", err)
+	}
+
+	envelope[1] = 9
+	if _, err := Open(key, envelope, []byte("ad")); !errors.Is(err, errUnknownAlgorithm) {
+		t.Errorf("Open with an unknown algorithm returned %v", err)
+	}
+	envelope[0] = 9
+	if _, err := Open(key, envelope, []byte("ad")); !errors.Is(err, errUnknownEnvelopeVersion) {
+		t.Errorf("Open with an unknown version returned %v", err)
+	}
+}
+
+func Test_Seal_InvalidKey_ExpectError(t *testing.T) {
+	if _, err := Seal(AlgorithmAES256GCM, make([]byte, 16), []byte("secret"), nil); !errors.Is(err, errInvalidKeySize) {
+		t.Errorf("Seal with a 16 bytes key returned %v", err)
+	}
+}
+
+func Test_Decrypt_LegacyCFB(t *testing.T) {
+	key := newTestKey(t)
+	legacy := encryptLegacyCFB(t, key, "password")
+	if !IsLegacyCiphertext(legacy) {
+		t.Errorf("IsLegacyCiphertext(%s) returned false", legacy)
+	}
+
+	if _, err := Decrypt(key, legacy, nil); !errors.Is(err, errLegacyDecryptionOff) {
+		t.Errorf("Decrypt of a legacy value by default returned %v", err)
+	}
+
+	if err := ConfigureEncryption(EncryptionConfiguration{AllowLegacyCFB: true}); err != nil {
+		t.Fatalf("ConfigureEncryption returned an error: %v", err)
+	}
+	defer ConfigureEncryption(EncryptionConfiguration{})
+
+	decrypted, err := Decrypt(key, legacy, []byte("ignored"))
+	if err != nil || decrypted != "password" {
+		t.Errorf("Decrypt of a legacy value returned %s, %v", decrypted, err)
+	}
+
+	if err := ConfigureEncryption(EncryptionConfiguration{AllowLegacyCFB: false}); err != nil {
+		t.Fatalf("ConfigureEncryption returned an error: %v", err)
+	}
+	if _, err := Decrypt(key, legacy, nil); !errors.Is(err, errLegacyDecryptionOff) {
+		t.Errorf("Decrypt of a legacy value with legacy decryption disabled returned %v", err)
+	}
+}
+
+func Test_ConfigureEncryption_SelectsAlgorithm(t *testing.T) {
+	defer ConfigureEncryption(EncryptionConfiguration{})
+
+	if err := ConfigureEncryption(EncryptionConfiguration{Algorithm: "xchacha20-poly1305"}); err != nil {
+		t.Fatalf("ConfigureEncryption returned an error: %v", err)
+	}
+
+	key := newTestKey(t)
+	encrypted, err := Encrypt(key, "value", nil)
+	if err != nil {
+		t.Fatalf("Encrypt returned an error: %v", err)
+	}
+	envelope, _ := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(encrypted, EnvelopePrefix))
+	if Algorithm(envelope[1]) != AlgorithmXChaCha20Poly1305 {
+		t.Errorf("Encrypt used %s", Algorithm(envelope[1]))
+	}
+
+	if err := ConfigureEncryption(EncryptionConfiguration{Algorithm: "des"}); !errors.Is(err, errUnknownAlgorithm) {
+		t.Errorf("ConfigureEncryption with an unknown algorithm returned %v", err)
+	}
+}
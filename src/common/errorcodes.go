@@ -0,0 +1,83 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errErrorCodeInvalidFormat = errors.New("invalid error code format")
+	errKeyringNotInitialized  = errors.New("error code keyring is not initialized")
+)
+
+// ErrorCodePayload is what an error code carries, encrypted, back to us through customers.
+type ErrorCodePayload struct {
+	Identifier string `json:"identifier" yaml:"identifier"`
+	Timestamp  int64  `json:"timestamp" yaml:"timestamp"`
+	RequestId  string `json:"request_id,omitempty" yaml:"request_id,omitempty"`
+	KeyId      string `json:"key_id,omitempty" yaml:"key_id,omitempty"`
+}
+
+// ErrorCodeKeyring encrypts error codes with the active key and decrypts them with any known key.
+type ErrorCodeKeyring struct {
+	keyring *Keyring
+}
+
+var errorCodeKeyring atomic.Pointer[ErrorCodeKeyring]
+
+// SetErrorCodeKeyring replaces the keyring used by the process. It is safe to call while serving requests.
+func SetErrorCodeKeyring(keyring *ErrorCodeKeyring) {
+	errorCodeKeyring.Store(keyring)
+}
+
+func CurrentErrorCodeKeyring() (*ErrorCodeKeyring, error) {
+	keyring := errorCodeKeyring.Load()
+	if keyring == nil {
+		return nil, errKeyringNotInitialized
+	}
+	return keyring, nil
+}
+
+func NewErrorCodeKeyring(config KeyringConfiguration) (*ErrorCodeKeyring, error) {
+	keyring, err := NewKeyring(config)
+	if err != nil {
+		return nil, err
+	}
+	return &ErrorCodeKeyring{keyring: keyring}, nil
+}
+
+// Encode encrypts the payload with the active key. The payload KeyId is ignored.
+func (k *ErrorCodeKeyring) Encode(payload ErrorCodePayload) (string, error) {
+	payload.KeyId = ""
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return k.keyring.Encrypt(string(plaintext), nil)
+}
+
+// Decode decrypts an error code produced by Encode with any key of the keyring.
+func (k *ErrorCodeKeyring) Decode(code string) (ErrorCodePayload, error) {
+	var payload ErrorCodePayload
+	plaintext, keyId, err := k.keyring.Decrypt(code, nil)
+	if errors.Is(err, errKeyringUnknownKey) {
+		return payload, err
+	}
+	if err != nil {
+		return payload, errErrorCodeInvalidFormat
+	}
+
+	if err := json.Unmarshal([]byte(plaintext), &payload); err != nil {
+		return payload, errErrorCodeInvalidFormat
+	}
+	payload.KeyId = keyId
+
+	return payload, nil
+}
+
+func NewErrorCodePayload(identifier, requestId string) ErrorCodePayload {
+	return ErrorCodePayload{Identifier: identifier, Timestamp: time.Now().Unix(), RequestId: requestId}
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	testErrorCodeKeyV1 = "LefWEePuYpZb+lVpb+3XwJDj/uuyluNWeE8RI08fiCM="
+	testErrorCodeKeyV2 = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+)
+
+func newTestKeyring(t *testing.T, activeKey string, keys ...KeyConfiguration) *ErrorCodeKeyring {
+	t.Helper()
+	keyring, err := NewErrorCodeKeyring(KeyringConfiguration{ActiveKey: activeKey, Keys: keys})
+	if err != nil {
+		t.Fatalf("NewErrorCodeKeyring returned an error: %v", err)
+	}
+	return keyring
+}
+
+func TestErrorCodeKeyring_EncodeDecode(t *testing.T) {
+	keyring := newTestKeyring(t, "v1", KeyConfiguration{Id: "v1", Value: testErrorCodeKeyV1})
+
+	code, err := keyring.Encode(NewErrorCodePayload("Workflows.CreateUser.1", "request-1"))
+	if err != nil {
+		t.Fatalf("Encode returned an error: %v", err)
+	}
+	if !strings.HasPrefix(code, "v1.") {
+		t.Errorf("Encode returned %s, want the v1 key id prefix", code)
+	}
+
+	payload, err := keyring.Decode(code)
+	if err != nil {
+		t.Fatalf("Decode returned an error: %v", err)
+	}
+	if payload.Identifier != "Workflows.CreateUser.1" || payload.RequestId != "request-1" || payload.KeyId != "v1" {
+		t.Errorf("Decode returned unexpected payload %+v", payload)
+	}
+	if payload.Timestamp == 0 {
+		t.Errorf("Decode returned a payload without timestamp")
+	}
+}
+
+func TestErrorCodeKeyring_Rotation_ExpectOldCodesDecoded(t *testing.T) {
+	old := newTestKeyring(t, "v1", KeyConfiguration{Id: "v1", Value: testErrorCodeKeyV1})
+	code, err := old.Encode(NewErrorCodePayload("Apis.GetUser.1", ""))
+	if err != nil {
+		t.Fatalf("Encode returned an error: %v", err)
+	}
+
+	rotated := newTestKeyring(t, "v2",
+		KeyConfiguration{Id: "v1", Value: testErrorCodeKeyV1},
+		KeyConfiguration{Id: "v2", Value: testErrorCodeKeyV2})
+
+	payload, err := rotated.Decode(code)
+	if err != nil {
+		t.Fatalf("Decode returned an error: %v", err)
+	}
+	if payload.Identifier != "Apis.GetUser.1" || payload.KeyId != "v1" {
+		t.Errorf("Decode returned unexpected payload %+v", payload)
+	}
+
+	newCode, err := rotated.Encode(NewErrorCodePayload("Apis.GetUser.1", ""))
+	if err != nil {
+		t.Fatalf("Encode returned an error: %v", err)
+	}
+	if !strings.HasPrefix(newCode, "v2.") {
+		t.Errorf("Encode returned %s, want the active v2 key id prefix", newCode)
+	}
+}
+
+func TestErrorCodeKeyring_Decode_ExpectError(t *testing.T) {
+	keyring := newTestKeyring(t, "v1", KeyConfiguration{Id: "v1", Value: testErrorCodeKeyV1})
+
+	if _, err := keyring.Decode("v9.abc"); !errors.Is(err, errKeyringUnknownKey) {
+		t.Errorf("Decode with unknown key returned %v", err)
+	}
+	if _, err := keyring.Decode("no-separator"); !errors.Is(err, errErrorCodeInvalidFormat) {
+		t.Errorf("Decode without key id returned %v", err)
+	}
+	if _, err := keyring.Decode("v1.abc"); !errors.Is(err, errErrorCodeInvalidFormat) {
+		t.Errorf("Decode with invalid ciphertext returned %v", err)
+	}
+}
+
+func TestNewErrorCodeKeyring_ExpectError(t *testing.T) {
+	_, err := NewErrorCodeKeyring(KeyringConfiguration{
+		ActiveKey: "v3",
+		Keys: []KeyConfiguration{
+			{Id: "v1", Value: testErrorCodeKeyV1},
+			{Id: "v1", Value: testErrorCodeKeyV2},
+			{Id: "v.2", Value: testErrorCodeKeyV2},
+			{Id: "v4", Value: "short"},
+		},
+	})
+	if err == nil {
+		t.Fatalf("NewErrorCodeKeyring returned no error")
+	}
+	for _, want := range []string{"keys[1]: duplicated id", "keys[2]: id is required", "keys[3]: value must be", `activeKey "v3"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("NewErrorCodeKeyring error %q does not contain %q", err, want)
+		}
+	}
+}
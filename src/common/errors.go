@@ -1,11 +1,30 @@
 package common
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type BackendError struct {
 	Identifier, Message string
 	Code                int
 	Err                 error
+	RequestId           string
+	// Args are the arguments of the message, to format it again in another language.
+	Args []any
+	// Violations lists every invalid field of a request that failed validation.
+	Violations []Violation
+	// RetryAfter tells clients when to try again, sent as the Retry-After header when set.
+	RetryAfter time.Duration
+}
+
+// Violation is a field of a request breaking one of its validation rules.
+type Violation struct {
+	Field   string `json:"field" yaml:"field"`
+	Rule    string `json:"rule" yaml:"rule"`
+	Message string `json:"message" yaml:"message"`
+	// Param is the parameter of the rule, e.g. the limit of max, to format the message again in another language.
+	Param string `json:"-" yaml:"-"`
 }
 
 func (e *BackendError) Error() string {
@@ -18,5 +37,18 @@ func NewBackendError(code int, identifier, message string, err error, a ...any)
 		Code:       code,
 		Message:    fmt.Sprintf(message, a...),
 		Err:        err,
+		Args:       a,
 	}
 }
+
+// WithViolations attaches the violations of a failed validation to the error.
+func (e *BackendError) WithViolations(violations []Violation) *BackendError {
+	e.Violations = violations
+	return e
+}
+
+// WithRetryAfter tells clients how long to wait before trying again.
+func (e *BackendError) WithRetryAfter(retryAfter time.Duration) *BackendError {
+	e.RetryAfter = retryAfter
+	return e
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const keyIdSeparator = "."
+
+var (
+	errKeyringInvalidFormat = errors.New("invalid encrypted value format")
+	errKeyringUnknownKey    = errors.New("unknown key")
+)
+
+type KeyConfiguration struct {
+	Id    string `json:"id" yaml:"id"`
+	Value string `json:"value" yaml:"value"`
+}
+
+type KeyringConfiguration struct {
+	ActiveKey string             `json:"activeKey" yaml:"activeKey"`
+	Keys      []KeyConfiguration `json:"keys" yaml:"keys"`
+}
+
+// Keyring encrypts with the active key and decrypts with any known key, so keys can be
+// rotated while values encrypted with older ones are still around. Encrypted values are
+// formatted as <key id>.<envelope> so the decrypting key can be found.
+type Keyring struct {
+	activeKey string
+	keys      map[string][]byte
+}
+
+func NewKeyring(config KeyringConfiguration) (*Keyring, error) {
+	var errs []error
+	keys := make(map[string][]byte, len(config.Keys))
+	for i, key := range config.Keys {
+		if key.Id == "" || strings.Contains(key.Id, keyIdSeparator) {
+			errs = append(errs, fmt.Errorf("keys[%d]: id is required and must not contain %q", i, keyIdSeparator))
+			continue
+		}
+		if _, ok := keys[key.Id]; ok {
+			errs = append(errs, fmt.Errorf("keys[%d]: duplicated id %s", i, key.Id))
+			continue
+		}
+		value, err := DecodeBase64(key.Value)
+		if err != nil || len(value) != KeySize {
+			errs = append(errs, fmt.Errorf("keys[%d]: value must be a base64 key of %d bytes", i, KeySize))
+			continue
+		}
+		keys[key.Id] = value
+	}
+
+	if _, ok := keys[config.ActiveKey]; !ok {
+		errs = append(errs, fmt.Errorf("activeKey %q does not match any key", config.ActiveKey))
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return &Keyring{activeKey: config.ActiveKey, keys: keys}, nil
+}
+
+func (k *Keyring) ActiveKey() string {
+	return k.activeKey
+}
+
+// Encrypt encrypts plaintext with the active key, binding the key id and associatedData to the ciphertext.
+func (k *Keyring) Encrypt(plaintext string, associatedData []byte) (string, error) {
+	ciphertext, err := Encrypt(k.keys[k.activeKey], plaintext, keyAssociatedData(k.activeKey, associatedData))
+	if err != nil {
+		return "", err
+	}
+
+	return k.activeKey + keyIdSeparator + ciphertext, nil
+}
+
+// Decrypt decrypts a value produced by Encrypt with any key of the keyring and returns the id of that key.
+func (k *Keyring) Decrypt(value string, associatedData []byte) (plaintext, keyId string, err error) {
+	keyId, ciphertext, ok := strings.Cut(strings.TrimSpace(value), keyIdSeparator)
+	if !ok || ciphertext == "" {
+		return "", "", errKeyringInvalidFormat
+	}
+
+	key, ok := k.keys[keyId]
+	if !ok {
+		return "", keyId, fmt.Errorf("%w %s", errKeyringUnknownKey, keyId)
+	}
+
+	plaintext, err = Decrypt(key, ciphertext, keyAssociatedData(keyId, associatedData))
+	if err != nil {
+		return "", keyId, err
+	}
+
+	return plaintext, keyId, nil
+}
+
+// KeyIdOf returns the id of the key a value produced by Keyring.Encrypt was encrypted with.
+func KeyIdOf(value string) string {
+	keyId, _, _ := strings.Cut(value, keyIdSeparator)
+	return keyId
+}
+
+func keyAssociatedData(keyId string, associatedData []byte) []byte {
+	return append([]byte(keyId+keyIdSeparator), associatedData...)
+}
+
+// IsKeyringCiphertext reports whether value looks like a value produced by Keyring.Encrypt.
+func IsKeyringCiphertext(value string) bool {
+	keyId, ciphertext, ok := strings.Cut(value, keyIdSeparator)
+	return ok && keyId != "" && strings.HasPrefix(ciphertext, EnvelopePrefix)
+}
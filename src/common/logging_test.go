@@ -0,0 +1,59 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func Test_NewLogger_AddsRequestId(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(LoggingConfiguration{Level: "debug", Format: "json"}, &buf)
+	if err != nil {
+		t.Fatalf("NewLogger returned an error: %v", err)
+	}
+
+	ctx := WithRequestId(context.Background(), "abc-123")
+	logger.With("layer", "test").DebugContext(ctx, "hello")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if line["request_id"] != "abc-123" {
+		t.Errorf("expected request_id abc-123, got %v", line["request_id"])
+	}
+	if line["layer"] != "test" {
+		t.Errorf("expected layer test, got %v", line["layer"])
+	}
+}
+
+func Test_NewLogger_InvalidConfiguration_ExpectError(t *testing.T) {
+	if _, err := NewLogger(LoggingConfiguration{Level: "verbose"}, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for invalid level, but got nil")
+	}
+	if _, err := NewLogger(LoggingConfiguration{Format: "xml"}, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for invalid format, but got nil")
+	}
+}
+
+func Test_NewLogger_RespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(LoggingConfiguration{Level: "warn"}, &buf)
+	if err != nil {
+		t.Fatalf("NewLogger returned an error: %v", err)
+	}
+
+	logger.Info("ignored")
+	if buf.Len() != 0 {
+		t.Errorf("expected info to be filtered, got %s", buf.String())
+	}
+
+	LogLevel.Set(slog.LevelInfo)
+	logger.Info("logged")
+	if buf.Len() == 0 {
+		t.Error("expected info to be logged after lowering the level")
+	}
+}
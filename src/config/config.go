@@ -0,0 +1,195 @@
+package config
+
+import (
+	"backend-sample/common"
+	"backend-sample/database"
+	"backend-sample/i18n"
+	"backend-sample/middlewares"
+	"backend-sample/tracing"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+const envPrefix = "APP"
+
+var errDurationWithoutUnit = errors.New("duration must have a unit, e.g. 60s")
+
+type ServerConfiguration struct {
+	Address           string        `json:"address" yaml:"address"`
+	ReadTimeout       time.Duration `json:"readTimeout" yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `json:"readHeaderTimeout" yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `json:"writeTimeout" yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `json:"idleTimeout" yaml:"idleTimeout"`
+	MaxHeaderBytes    int           `json:"maxHeaderBytes" yaml:"maxHeaderBytes"`
+	ShutdownTimeout   time.Duration `json:"shutdownTimeout" yaml:"shutdownTimeout"`
+}
+
+type HealthConfiguration struct {
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+}
+
+type AdminConfiguration struct {
+	Token string `json:"token" yaml:"token"`
+}
+
+type Configuration struct {
+	Server     ServerConfiguration            `json:"server" yaml:"server"`
+	Database   database.DatabaseConfiguration `json:"database" yaml:"database"`
+	Logging    common.LoggingConfiguration    `json:"logging" yaml:"logging"`
+	Tracing    tracing.TracingConfiguration   `json:"tracing" yaml:"tracing"`
+	Health     HealthConfiguration            `json:"health" yaml:"health"`
+	Admin      AdminConfiguration             `json:"admin" yaml:"admin"`
+	ErrorCodes common.KeyringConfiguration    `json:"errorCodes" yaml:"errorCodes"`
+	Encryption common.EncryptionConfiguration `json:"encryption" yaml:"encryption"`
+	// FieldEncryption holds the keys of the columns encrypted at rest.
+	FieldEncryption database.FieldEncryptionConfiguration `json:"fieldEncryption" yaml:"fieldEncryption"`
+	Localization    i18n.LocalizationConfiguration        `json:"localization" yaml:"localization"`
+	// LoadShedding limits the requests handled at once, rejecting the excess with 503.
+	LoadShedding middlewares.ConcurrencyLimitConfiguration `json:"loadShedding" yaml:"loadShedding"`
+	// Cache serves users by id without querying the database.
+	Cache database.CacheConfiguration `json:"cache" yaml:"cache"`
+	// Timeouts bounds how long the queries of a request may run.
+	Timeouts middlewares.TimeoutConfiguration `json:"timeouts" yaml:"timeouts"`
+}
+
+// Options tells where the configuration is read from. The base file <Path>/<Name>.yml is
+// loaded first, then <Path>/<Name>.<Profile>.yml is merged over it when a profile is set.
+type Options struct {
+	Path    string
+	Name    string
+	Profile string
+}
+
+// RegisterFlags binds the -config, -config-name and -profile flags, defaulting to the
+// APP_CONFIG_PATH, APP_CONFIG_NAME and APP_PROFILE environment variables.
+func RegisterFlags(flags *flag.FlagSet) *Options {
+	options := &Options{}
+	flags.StringVar(&options.Path, "config", getEnv(envPrefix+"_CONFIG_PATH", "../configs"), "directory containing the configuration files")
+	flags.StringVar(&options.Name, "config-name", getEnv(envPrefix+"_CONFIG_NAME", "db"), "name of the base configuration file, without extension")
+	flags.StringVar(&options.Profile, "profile", getEnv(envPrefix+"_PROFILE", ""), "configuration profile merged over the base file, e.g. dev or prod")
+	return options
+}
+
+// Load reads, merges and validates the configuration. Environment variables named after
+// the key path, such as APP_DATABASE_HOST, override values from the files. Values written
+// as file:<path>, env:<name> or enc:<ciphertext> are replaced by the secret they reference.
+func Load(options Options) (*Configuration, error) {
+	v, err := newViper(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Configuration
+	if err := v.Unmarshal(&config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		durationWithUnitHookFunc(),
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	if err := resolveSecrets(&config); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+func newViper(options Options) (*viper.Viper, error) {
+	v := viper.New()
+	setDefaults(v)
+
+	v.SetConfigType("yaml")
+	v.SetConfigFile(configFile(options.Path, options.Name, ""))
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	if options.Profile != "" {
+		v.SetConfigFile(configFile(options.Path, options.Name, options.Profile))
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("error reading profile %s: %w", options.Profile, err)
+		}
+	}
+
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	bindEnvs(v, "", reflect.TypeOf(Configuration{}))
+
+	return v, nil
+}
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.address", ":8080")
+	v.SetDefault("server.readHeaderTimeout", "5s")
+	v.SetDefault("server.shutdownTimeout", "30s")
+	v.SetDefault("database.port", 3306)
+	v.SetDefault("database.connectTimeout", "5s")
+	v.SetDefault("database.charset", "utf8mb4")
+	v.SetDefault("database.tls.mode", "verify")
+	v.SetDefault("database.startupTimeout", "30s")
+	v.SetDefault("logging.level", "info")
+	v.SetDefault("logging.format", "json")
+	v.SetDefault("tracing.exporter", "none")
+	v.SetDefault("tracing.sampleRatio", 1.0)
+	v.SetDefault("health.timeout", "2s")
+	v.SetDefault("encryption.algorithm", "aes-256-gcm")
+}
+
+func configFile(path, name, profile string) string {
+	if profile != "" {
+		name += "." + profile
+	}
+	return strings.TrimRight(path, "/") + "/" + name + ".yml"
+}
+
+// bindEnvs registers an environment variable for every leaf field, so overrides also
+// apply to keys missing from the files.
+func bindEnvs(v *viper.Viper, prefix string, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + strings.ToLower(field.Name)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			bindEnvs(v, key+".", field.Type)
+			continue
+		}
+		v.BindEnv(key)
+	}
+}
+
+// durationWithUnitHookFunc rejects bare numbers for durations, which would otherwise be read as nanoseconds.
+func durationWithUnitHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from reflect.Type, to reflect.Type, data any) (any, error) {
+		if to != reflect.TypeOf(time.Duration(0)) {
+			return data, nil
+		}
+
+		switch from.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return nil, fmt.Errorf("%v: %w", data, errDurationWithoutUnit)
+		}
+
+		return data, nil
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const baseConfig = `
+database:
+  host: "localhost"
+  database: "users"
+  user: "root"
+  password: "password"
+  port: 3306
+  maxLifetime: "60s"
+  maxOpenConns: 5
+  maxIdleConns: 5
+errorCodes:
+  activeKey: "v1"
+  keys:
+    - id: "v1"
+      value: "` + errorCodeKey + `"
+fieldEncryption:
+  activeKey: "v1"
+  keys:
+    - id: "v1"
+      value: "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+  indexKey: "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+`
+
+const errorCodeKey = "LefWEePuYpZb+lVpb+3XwJDj/uuyluNWeE8RI08fiCM="
+
+func writeConfig(t *testing.T, dir, name, content string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatalf("could not write %s: %v", name, err)
+	}
+}
+
+func Test_Load_ExpectDefaults(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "db.yml", baseConfig)
+
+	config, err := Load(Options{Path: dir, Name: "db"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost", config.Database.Host)
+	assert.Equal(t, 60*time.Second, config.Database.MaxLifetime)
+	assert.Equal(t, ":8080", config.Server.Address)
+	assert.Equal(t, 2*time.Second, config.Health.Timeout)
+	assert.Equal(t, "v1", config.ErrorCodes.ActiveKey)
+}
+
+func Test_Load_ProfileMergedOverBase(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "db.yml", baseConfig)
+	writeConfig(t, dir, "db.prod.yml", "database:\n  host: \"users-db\"\n  maxOpenConns: 20\n")
+
+	config, err := Load(Options{Path: dir, Name: "db", Profile: "prod"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "users-db", config.Database.Host)
+	assert.Equal(t, 20, config.Database.MaxOpenConns)
+	assert.Equal(t, "users", config.Database.Database)
+}
+
+func Test_Load_MissingProfile_ExpectError(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "db.yml", baseConfig)
+
+	_, err := Load(Options{Path: dir, Name: "db", Profile: "staging"})
+
+	assert.ErrorContains(t, err, "staging")
+}
+
+func Test_Load_EnvironmentOverrides(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "db.yml", baseConfig)
+	t.Setenv("APP_DATABASE_HOST", "db.internal")
+	t.Setenv("APP_DATABASE_PORT", "3307")
+	t.Setenv("APP_SERVER_WRITETIMEOUT", "15s")
+
+	config, err := Load(Options{Path: dir, Name: "db"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "db.internal", config.Database.Host)
+	assert.Equal(t, 3307, config.Database.Port)
+	assert.Equal(t, 15*time.Second, config.Server.WriteTimeout)
+}
+
+func Test_Load_DurationWithoutUnit_ExpectError(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "db.yml", baseConfig)
+	writeConfig(t, dir, "db.dev.yml", "database:\n  maxLifetime: 60\n")
+
+	_, err := Load(Options{Path: dir, Name: "db", Profile: "dev"})
+
+	assert.ErrorContains(t, err, errDurationWithoutUnit.Error())
+}
+
+func Test_Load_InvalidConfiguration_ReportsEveryError(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "db.yml", `
+database:
+  host: ""
+  user: "root"
+  port: 70000
+  maxOpenConns: 5
+  maxIdleConns: 10
+logging:
+  level: "verbose"
+cache:
+  backend: "redis"
+`)
+
+	_, err := Load(Options{Path: dir, Name: "db"})
+
+	assert.Error(t, err)
+	assert.ErrorContains(t, err, "database.host is required")
+	assert.ErrorContains(t, err, "database.database is required")
+	assert.ErrorContains(t, err, "database.port must be between 1 and 65535")
+	assert.ErrorContains(t, err, "database.maxIdleConns must be between 0 and database.maxOpenConns")
+	assert.ErrorContains(t, err, "logging.level")
+	assert.ErrorContains(t, err, "cache.redis.address is required")
+	assert.ErrorContains(t, err, `errorCodes: activeKey "" does not match any key`)
+	assert.ErrorContains(t, err, `fieldEncryption: activeKey "" does not match any key`)
+}
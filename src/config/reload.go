@@ -0,0 +1,70 @@
+package config
+
+import (
+	"backend-sample/database"
+	"log/slog"
+	"reflect"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Watch reloads the configuration whenever the base or the profile file changes and passes
+// it to apply once it is valid. Invalid edits are logged and the running configuration is kept.
+func Watch(options Options, apply func(*Configuration)) {
+	reload := func(event fsnotify.Event) {
+		config, err := Load(options)
+		if err != nil {
+			slog.Error("configuration change rejected", "file", event.Name, "error", err)
+			return
+		}
+
+		slog.Info("configuration reloaded", "file", event.Name)
+		apply(config)
+	}
+
+	files := []string{configFile(options.Path, options.Name, "")}
+	if options.Profile != "" {
+		files = append(files, configFile(options.Path, options.Name, options.Profile))
+	}
+
+	for _, file := range files {
+		watcher := viper.New()
+		watcher.SetConfigFile(file)
+		watcher.OnConfigChange(reload)
+		watcher.WatchConfig()
+	}
+}
+
+// RestartRequired lists the sections changed between two configurations that cannot be
+// applied to the running process.
+func RestartRequired(previous, next *Configuration) []string {
+	var sections []string
+	if previous.Server != next.Server {
+		sections = append(sections, "server")
+	}
+
+	previousConnection, nextConnection := previous.Database, next.Database
+	previousConnection.MaxOpenConns, previousConnection.MaxIdleConns, previousConnection.MaxLifetime = 0, 0, 0
+	nextConnection.MaxOpenConns, nextConnection.MaxIdleConns, nextConnection.MaxLifetime = 0, 0, 0
+	previousConnection.Retry, nextConnection.Retry = database.RetryConfiguration{}, database.RetryConfiguration{}
+	previousConnection.CircuitBreaker, nextConnection.CircuitBreaker = database.CircuitBreakerConfiguration{}, database.CircuitBreakerConfiguration{}
+	if !reflect.DeepEqual(previousConnection, nextConnection) {
+		sections = append(sections, "database")
+	}
+
+	if previous.Logging.Format != next.Logging.Format {
+		sections = append(sections, "logging.format")
+	}
+	if previous.Tracing != next.Tracing {
+		sections = append(sections, "tracing")
+	}
+	if previous.Health != next.Health {
+		sections = append(sections, "health")
+	}
+	if previous.Cache != next.Cache {
+		sections = append(sections, "cache")
+	}
+
+	return sections
+}
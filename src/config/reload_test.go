@@ -0,0 +1,59 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Watch_AppliesValidChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "db.yml", baseConfig)
+
+	applied := make(chan *Configuration, 10)
+	Watch(Options{Path: dir, Name: "db"}, func(config *Configuration) { applied <- config })
+	time.Sleep(50 * time.Millisecond)
+
+	writeConfig(t, dir, "db.yml", strings.Replace(baseConfig, "maxOpenConns: 5", "maxOpenConns: 50", 1))
+
+	select {
+	case config := <-applied:
+		assert.Equal(t, 50, config.Database.MaxOpenConns)
+	case <-time.After(5 * time.Second):
+		t.Fatal("configuration change was not applied")
+	}
+}
+
+func Test_Watch_RejectsInvalidChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "db.yml", baseConfig)
+
+	applied := make(chan *Configuration, 10)
+	Watch(Options{Path: dir, Name: "db"}, func(config *Configuration) { applied <- config })
+	time.Sleep(50 * time.Millisecond)
+
+	writeConfig(t, dir, "db.yml", strings.Replace(baseConfig, "maxOpenConns: 5", "maxOpenConns: 0", 1))
+
+	select {
+	case config := <-applied:
+		t.Fatalf("invalid configuration was applied: %+v", config.Database)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func Test_RestartRequired_ExpectChangedSections(t *testing.T) {
+	previous := &Configuration{}
+	previous.Database.Host = "localhost"
+	previous.Database.MaxOpenConns = 5
+
+	next := *previous
+	next.Database.MaxOpenConns = 10
+	next.Logging.Level = "debug"
+	assert.Empty(t, RestartRequired(previous, &next))
+
+	next.Database.Host = "db.internal"
+	next.Server.Address = ":9090"
+	assert.Equal(t, []string{"server", "database"}, RestartRequired(previous, &next))
+}
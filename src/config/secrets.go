@@ -0,0 +1,156 @@
+package config
+
+import (
+	"backend-sample/common"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Prefixes of configuration values that reference a secret instead of holding it.
+const (
+	SecretFilePrefix      = "file:"
+	SecretEnvPrefix       = "env:"
+	SecretEncryptedPrefix = "enc:"
+)
+
+const (
+	masterKeyEnv     = envPrefix + "_MASTER_KEY"
+	masterKeyFileEnv = envPrefix + "_MASTER_KEY_FILE"
+)
+
+// secretAssociatedData is authenticated with every encrypted secret, so values encrypted for
+// another purpose with the same key are rejected.
+var secretAssociatedData = []byte("backend-sample/config-secret")
+
+var errLegacySecret = errors.New("legacy CFB secret must be encrypted again with encrypt-secret")
+
+var errMasterKeyNotSet = fmt.Errorf("master key is not set, use %s or %s", masterKeyEnv, masterKeyFileEnv)
+
+// MasterKeyFromEnvironment reads the base64 master key from APP_MASTER_KEY, or from the
+// file named by APP_MASTER_KEY_FILE.
+func MasterKeyFromEnvironment() ([]byte, error) {
+	encoded, ok := os.LookupEnv(masterKeyEnv)
+	if !ok {
+		path, ok := os.LookupEnv(masterKeyFileEnv)
+		if !ok {
+			return nil, errMasterKeyNotSet
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read master key file: %w", err)
+		}
+		encoded = string(content)
+	}
+
+	key, err := common.DecodeBase64(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key is not valid base64: %w", err)
+	}
+	if len(key) != common.KeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", common.KeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// EncryptSecret returns the enc: value to put in the configuration for a secret.
+func EncryptSecret(masterKey []byte, value string) (string, error) {
+	encrypted, err := common.Encrypt(masterKey, value, secretAssociatedData)
+	if err != nil {
+		return "", err
+	}
+	return SecretEncryptedPrefix + encrypted, nil
+}
+
+// resolveSecrets replaces every string field referencing a secret with its value. The
+// master key is only read when an encrypted value is found.
+func resolveSecrets(config *Configuration) error {
+	var masterKey []byte
+	var masterKeyErr error
+	getMasterKey := func() ([]byte, error) {
+		if masterKey == nil && masterKeyErr == nil {
+			masterKey, masterKeyErr = MasterKeyFromEnvironment()
+		}
+		return masterKey, masterKeyErr
+	}
+
+	var errs []error
+	walkStrings(reflect.ValueOf(config).Elem(), "", func(path string, value reflect.Value) {
+		encrypted, ok := strings.CutPrefix(value.String(), SecretEncryptedPrefix)
+		if ok && !config.Encryption.AllowLegacyCFB && common.IsLegacyCiphertext(encrypted) {
+			errs = append(errs, fmt.Errorf("%s: %w", path, errLegacySecret))
+			return
+		}
+		resolved, err := resolveSecret(value.String(), getMasterKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			return
+		}
+		value.SetString(resolved)
+	})
+
+	return errors.Join(errs...)
+}
+
+func resolveSecret(value string, masterKey func() ([]byte, error)) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretFilePrefix):
+		path := strings.TrimPrefix(value, SecretFilePrefix)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read secret file %s", path)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, SecretEncryptedPrefix):
+		key, err := masterKey()
+		if err != nil {
+			return "", err
+		}
+		secret, err := common.Decrypt(key, strings.TrimPrefix(value, SecretEncryptedPrefix), secretAssociatedData)
+		if err != nil {
+			return "", fmt.Errorf("could not decrypt secret: %w", err)
+		}
+		return secret, nil
+	default:
+		return value, nil
+	}
+}
+
+// walkStrings calls visit for every settable string reachable from value, with its key path.
+func walkStrings(value reflect.Value, path string, visit func(path string, value reflect.Value)) {
+	switch value.Kind() {
+	case reflect.String:
+		if value.CanSet() {
+			visit(path, value)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "" {
+				name = field.Name
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			walkStrings(value.Field(i), name, visit)
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			walkStrings(value.Index(i), fmt.Sprintf("%s[%d]", path, i), visit)
+		}
+	}
+}
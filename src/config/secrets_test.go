@@ -0,0 +1,69 @@
+package config
+
+import (
+	"backend-sample/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Load_ResolvesSecrets(t *testing.T) {
+	masterKey, _ := common.GenerateAESKey(32)
+	encrypted, err := EncryptSecret(masterKey, errorCodeKey)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "db_password")
+	writeConfig(t, dir, "db_password", "file-password\n")
+	config := strings.Replace(baseConfig, `password: "password"`, `password: "file:`+secretFile+`"`, 1)
+	config = strings.Replace(config, `user: "root"`, `user: "env:TEST_DB_USER"`, 1)
+	config = strings.Replace(config, errorCodeKey, encrypted, 1)
+	writeConfig(t, dir, "db.yml", config)
+
+	t.Setenv("TEST_DB_USER", "app")
+	t.Setenv(masterKeyEnv, common.EncodeBase64(masterKey))
+
+	loaded, err := Load(Options{Path: dir, Name: "db"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "file-password", loaded.Database.Password)
+	assert.Equal(t, "app", loaded.Database.User)
+	assert.Equal(t, errorCodeKey, loaded.ErrorCodes.Keys[0].Value)
+}
+
+func Test_Load_UnresolvedSecrets_ReportsEveryError(t *testing.T) {
+	dir := t.TempDir()
+	config := strings.Replace(baseConfig, `password: "password"`, `password: "file:/does/not/exist"`, 1)
+	config = strings.Replace(config, `user: "root"`, `user: "env:TEST_MISSING_USER"`, 1)
+	config = strings.Replace(config, errorCodeKey, "enc:"+common.EnvelopePrefix+"abc", 1)
+	writeConfig(t, dir, "db.yml", config)
+	os.Unsetenv(masterKeyEnv)
+	os.Unsetenv(masterKeyFileEnv)
+
+	_, err := Load(Options{Path: dir, Name: "db"})
+
+	assert.ErrorContains(t, err, "database.password: could not read secret file /does/not/exist")
+	assert.ErrorContains(t, err, "database.user: environment variable TEST_MISSING_USER is not set")
+	assert.ErrorContains(t, err, "errorCodes.keys[0].value: "+errMasterKeyNotSet.Error())
+}
+
+func Test_Load_LegacySecretByDefault_ExpectError(t *testing.T) {
+	dir := t.TempDir()
+	config := strings.Replace(baseConfig, errorCodeKey, "enc:abc", 1)
+	writeConfig(t, dir, "db.yml", config)
+
+	_, err := Load(Options{Path: dir, Name: "db"})
+
+	assert.ErrorContains(t, err, "errorCodes.keys[0].value: "+errLegacySecret.Error())
+}
+
+func Test_MasterKeyFromEnvironment_InvalidKey_ExpectError(t *testing.T) {
+	t.Setenv(masterKeyEnv, common.EncodeBase64([]byte("short")))
+
+	_, err := MasterKeyFromEnvironment()
+
+	assert.ErrorContains(t, err, "master key must be 32 bytes")
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"backend-sample/common"
+	"backend-sample/database"
+	"backend-sample/i18n"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const maxPoolSize = 1000
+
+// Validate checks the whole configuration and reports every problem found at once.
+func (c *Configuration) Validate() error {
+	var errs []error
+	add := func(format string, a ...any) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+
+	if c.Server.Address == "" {
+		add("server.address is required")
+	}
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.readTimeout", c.Server.ReadTimeout},
+		{"server.readHeaderTimeout", c.Server.ReadHeaderTimeout},
+		{"server.writeTimeout", c.Server.WriteTimeout},
+		{"server.idleTimeout", c.Server.IdleTimeout},
+		{"server.shutdownTimeout", c.Server.ShutdownTimeout},
+		{"health.timeout", c.Health.Timeout},
+		{"database.maxLifetime", c.Database.MaxLifetime},
+		{"database.connectTimeout", c.Database.ConnectTimeout},
+		{"database.readTimeout", c.Database.ReadTimeout},
+		{"database.writeTimeout", c.Database.WriteTimeout},
+		{"database.startupTimeout", c.Database.StartupTimeout},
+		{"database.retry.initialBackoff", c.Database.Retry.InitialBackoff},
+		{"database.retry.maxBackoff", c.Database.Retry.MaxBackoff},
+		{"database.circuitBreaker.openTimeout", c.Database.CircuitBreaker.OpenTimeout},
+		{"database.replication.stickyWindow", c.Database.Replication.StickyWindow},
+		{"database.replication.healthInterval", c.Database.Replication.HealthInterval},
+		{"cache.ttl", c.Cache.TTL},
+		{"cache.negativeTtl", c.Cache.NegativeTTL},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			add("%s must not be negative", duration.name)
+		}
+	}
+	if c.Server.MaxHeaderBytes < 0 {
+		add("server.maxHeaderBytes must not be negative")
+	}
+
+	db := c.Database
+	if db.Host == "" {
+		add("database.host is required")
+	} else if err := database.ValidateHost(db.Host); err != nil {
+		add("database.host: %w", err)
+	}
+	if db.Database == "" {
+		add("database.database is required")
+	}
+	if db.User == "" {
+		add("database.user is required")
+	}
+	if db.Port < 1 || db.Port > 65535 {
+		add("database.port must be between 1 and 65535, got %d", db.Port)
+	}
+	if db.MaxOpenConns < 1 || db.MaxOpenConns > maxPoolSize {
+		add("database.maxOpenConns must be between 1 and %d, got %d", maxPoolSize, db.MaxOpenConns)
+	}
+	if db.MaxIdleConns < 0 || db.MaxIdleConns > db.MaxOpenConns {
+		add("database.maxIdleConns must be between 0 and database.maxOpenConns, got %d", db.MaxIdleConns)
+	}
+	if db.MaxLifetime > 0 && db.MaxLifetime < time.Second {
+		add("database.maxLifetime must be a duration with a unit, e.g. 60s, got %s", db.MaxLifetime)
+	}
+	switch strings.ToLower(db.TLS.Mode) {
+	case "", database.TLSModeVerify, database.TLSModeSkipVerify, database.TLSModePreferred, database.TLSModeDisabled:
+	default:
+		add("database.tls.mode must be verify, skip-verify, preferred or disabled, got %s", db.TLS.Mode)
+	}
+	if (db.TLS.CertFile == "") != (db.TLS.KeyFile == "") {
+		add("database.tls.certFile and database.tls.keyFile must be set together")
+	}
+	if db.Retry.MaxAttempts < 0 {
+		add("database.retry.maxAttempts must not be negative, got %d", db.Retry.MaxAttempts)
+	}
+	if db.CircuitBreaker.FailureThreshold < -1 {
+		add("database.circuitBreaker.failureThreshold must be -1 to disable it or positive, got %d", db.CircuitBreaker.FailureThreshold)
+	}
+	for i, replica := range db.Replication.Replicas {
+		if err := database.ValidateHost(replica.Host); err != nil {
+			add("database.replication.replicas[%d].host: %w", i, err)
+		}
+		if replica.Port < 1 || replica.Port > 65535 {
+			add("database.replication.replicas[%d].port must be between 1 and 65535, got %d", i, replica.Port)
+		}
+	}
+	if err := database.ValidateSelection(db.Replication.Selection); err != nil {
+		add("database.replication.selection: %w", err)
+	}
+	if db.CircuitBreaker.HalfOpenRequests < 0 {
+		add("database.circuitBreaker.halfOpenRequests must not be negative, got %d", db.CircuitBreaker.HalfOpenRequests)
+	}
+
+	if shedding := c.LoadShedding; shedding.Enabled {
+		if shedding.MinLimit < 1 || shedding.MinLimit > shedding.InitialLimit || shedding.InitialLimit > shedding.MaxLimit {
+			add("loadShedding limits must satisfy 1 <= minLimit <= initialLimit <= maxLimit, got %d, %d and %d",
+				shedding.MinLimit, shedding.InitialLimit, shedding.MaxLimit)
+		}
+		if shedding.LatencyTarget <= 0 {
+			add("loadShedding.latencyTarget must be positive")
+		}
+	}
+
+	if err := database.ValidateCacheBackend(c.Cache.Backend); err != nil {
+		add("cache.backend: %w", err)
+	}
+	if c.Cache.Size < 0 {
+		add("cache.size must not be negative, got %d", c.Cache.Size)
+	}
+	if strings.EqualFold(c.Cache.Backend, database.CacheBackendRedis) && c.Cache.Redis.Address == "" {
+		add("cache.redis.address is required with the redis backend")
+	}
+
+	if c.Timeouts.Default < 0 {
+		add("timeouts.default must not be negative")
+	}
+	if c.Timeouts.Stream < 0 {
+		add("timeouts.stream must not be negative")
+	}
+	for i, route := range c.Timeouts.Routes {
+		if route.Method == "" || !strings.HasPrefix(route.Path, "/") {
+			add("timeouts.routes[%d] needs a method and a path starting with /", i)
+		}
+		if route.Timeout < 0 {
+			add("timeouts.routes[%d].timeout must not be negative", i)
+		}
+	}
+
+	if _, err := common.ParseLogLevel(c.Logging.Level); err != nil {
+		add("logging.level: %w", err)
+	}
+	if format := strings.ToLower(c.Logging.Format); format != "" && format != "json" && format != "text" {
+		add("logging.format must be json or text, got %s", c.Logging.Format)
+	}
+
+	switch strings.ToLower(c.Tracing.Exporter) {
+	case "", "none", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			add("tracing.file is required when tracing.exporter is file")
+		}
+	case "otlp":
+		if c.Tracing.Endpoint == "" {
+			add("tracing.endpoint is required when tracing.exporter is otlp")
+		}
+	default:
+		add("tracing.exporter must be none, stdout, file or otlp, got %s", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sampleRatio must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if _, err := common.NewErrorCodeKeyring(c.ErrorCodes); err != nil {
+		add("errorCodes: %w", err)
+	}
+	if _, err := database.NewFieldEncryptor(c.FieldEncryption); err != nil {
+		add("fieldEncryption: %w", err)
+	}
+	if _, err := i18n.Load(c.Localization); err != nil {
+		add("localization: %w", err)
+	}
+	if _, err := common.ParseAlgorithm(c.Encryption.Algorithm); err != nil {
+		add("encryption.algorithm: %w", err)
+	}
+
+	return errors.Join(errs...)
+}
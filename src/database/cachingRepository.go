@@ -0,0 +1,222 @@
+package database
+
+import (
+	"backend-sample/common"
+	"backend-sample/metrics"
+	"backend-sample/tracing"
+	"context"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
+)
+
+// cachingRepository serves the users read by id from a cache in front of the repository. Writes made
+// through it invalidate the user, other entries go stale for at most the TTL. The cache is filled
+// from the primary, a lagging replica would keep an old user cached for everyone.
+type cachingRepository struct {
+	UsersRepository
+	cache       UserCache
+	ttl         time.Duration
+	negativeTTL time.Duration
+	loads       singleflight.Group
+	// generations counts the invalidations of the ids hashing to each slot. A fill read before an
+	// invalidation is not cached, and reads after it do not join the loads started before it.
+	generations [256]atomic.Uint64
+}
+
+// NewCachingRepository decorates repository with cache. Cache failures are logged and the
+// repository is used instead, the cache only saves queries.
+func NewCachingRepository(repository UsersRepository, cache UserCache, config CacheConfiguration) UsersRepository {
+	config = config.withDefaults()
+	return &cachingRepository{UsersRepository: repository, cache: cache, ttl: config.TTL, negativeTTL: config.NegativeTTL}
+}
+
+func (repo *cachingRepository) CreateUser(ctx context.Context, name, email, password string) (*UserEntity, *common.BackendError) {
+	user, berr := repo.UsersRepository.CreateUser(ctx, name, email, password)
+	if berr == nil {
+		repo.fill(ctx, user.Id, user, repo.ttl, repo.generation(user.Id))
+	}
+	return user, berr
+}
+
+func (repo *cachingRepository) UpdateUser(ctx context.Context, user UserEntity) *common.BackendError {
+	// Invalidated even on failure, the update may have been applied before the error.
+	defer repo.invalidate(ctx, user.Id)
+	return repo.UsersRepository.UpdateUser(ctx, user)
+}
+
+func (repo *cachingRepository) DeleteUser(ctx context.Context, id uuid.UUID) *common.BackendError {
+	defer repo.invalidate(ctx, id)
+	return repo.UsersRepository.DeleteUser(ctx, id)
+}
+
+func (repo *cachingRepository) GetUserById(ctx context.Context, id uuid.UUID) (_ *UserEntity, berr *common.BackendError) {
+	ctx, span := tracing.Start(ctx, "repository.cache.GetUserById")
+	defer func() { tracing.End(span, berr) }()
+
+	user, found := repo.get(ctx, id)
+	span.SetAttributes(attribute.Bool("cache.hit", found))
+	switch {
+	case found && user == nil:
+		return nil, common.NewBackendError(404, "GetUserById.3", "user not found for id %s", nil, id.String())
+	case found:
+		return user, nil
+	}
+
+	return repo.load(ctx, id)
+}
+
+// GetUsersByIds serves the cached users and queries the others with one batch.
+func (repo *cachingRepository) GetUsersByIds(ctx context.Context, ids []uuid.UUID) (_ *[]UserEntity, berr *common.BackendError) {
+	ctx, span := tracing.Start(ctx, "repository.cache.GetUsersByIds")
+	defer func() { tracing.End(span, berr) }()
+
+	ids = uniqueIds(ids)
+	users := make([]UserEntity, 0, len(ids))
+	var missing []uuid.UUID
+	for _, id := range ids {
+		user, found := repo.get(ctx, id)
+		switch {
+		case !found:
+			missing = append(missing, id)
+		case user != nil:
+			users = append(users, *user)
+		}
+	}
+	span.SetAttributes(attribute.Int("cache.misses", len(missing)))
+	if len(missing) == 0 {
+		return &users, nil
+	}
+
+	generations := make(map[uuid.UUID]uint64, len(missing))
+	for _, id := range missing {
+		generations[id] = repo.generation(id)
+	}
+	loaded, berr := repo.UsersRepository.GetUsersByIds(readFromPrimary(ctx), missing)
+	if berr != nil {
+		return nil, berr
+	}
+	for _, user := range *loaded {
+		repo.fill(ctx, user.Id, &user, repo.ttl, generations[user.Id])
+		delete(generations, user.Id)
+		users = append(users, user)
+	}
+	for id, generation := range generations {
+		repo.fill(ctx, id, nil, repo.negativeTTL, generation)
+	}
+	return &users, nil
+}
+
+// get returns the cached user of id, found reporting a hit, positive or negative. Cache failures
+// count as misses.
+func (repo *cachingRepository) get(ctx context.Context, id uuid.UUID) (*UserEntity, bool) {
+	user, found, err := repo.cache.Get(ctx, id)
+	switch {
+	case err != nil:
+		metrics.RepositoryCacheRequests.WithLabelValues("error").Inc()
+		slog.WarnContext(ctx, "could not read user from cache", "user_id", id, "error", err)
+		return nil, false
+	case found && user == nil:
+		metrics.RepositoryCacheRequests.WithLabelValues("negative_hit").Inc()
+	case found:
+		metrics.RepositoryCacheRequests.WithLabelValues("hit").Inc()
+	default:
+		metrics.RepositoryCacheRequests.WithLabelValues("miss").Inc()
+	}
+	return user, found
+}
+
+type loadResult struct {
+	user *UserEntity
+	berr *common.BackendError
+}
+
+// load reads the user from the primary, concurrent misses of an id sharing a single query. The
+// query does not stop when the caller that started it goes away, only at its deadline, so the
+// others still get the user. Misses after an invalidation of id start a new query.
+func (repo *cachingRepository) load(ctx context.Context, id uuid.UUID) (*UserEntity, *common.BackendError) {
+	generation := repo.generation(id)
+	key := id.String() + "/" + strconv.FormatUint(generation, 10)
+	results := repo.loads.DoChan(key, func() (any, error) {
+		loadCtx, cancel := detach(ctx)
+		defer cancel()
+		loadCtx = readFromPrimary(loadCtx)
+
+		// A caller missing just before the previous load cached the user may start a new load once
+		// that one is done, the cache is checked again so it does not query the user twice.
+		if user, found, err := repo.cache.Get(loadCtx, id); err == nil && found {
+			if user == nil {
+				return loadResult{berr: common.NewBackendError(404, "GetUserById.3", "user not found for id %s", nil, id.String())}, nil
+			}
+			return loadResult{user: user}, nil
+		}
+
+		user, berr := repo.UsersRepository.GetUserById(loadCtx, id)
+		switch {
+		case berr == nil:
+			repo.fill(loadCtx, id, user, repo.ttl, generation)
+		case berr.Code == 404:
+			repo.fill(loadCtx, id, nil, repo.negativeTTL, generation)
+		}
+		return loadResult{user: user, berr: berr}, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, classifyError(ctx.Err(), common.NewBackendError(500, "GetUserById.2", "error querying user by id %s.", ctx.Err(), id.String()))
+	case result := <-results:
+		loaded := result.Val.(loadResult)
+		// Every caller gets its own copy, workflows modify the user before updating it.
+		return copyUser(loaded.user), loaded.berr
+	}
+}
+
+// detach returns a context with the values and deadline of ctx that is not canceled with it.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
+
+// generation returns the invalidation count of id, read before querying the user to cache.
+func (repo *cachingRepository) generation(id uuid.UUID) uint64 {
+	return repo.generations[id[0]].Load()
+}
+
+// fill caches the user of id read at generation, unless id was invalidated since then. The
+// generation is checked again once cached, an invalidation running meanwhile may have missed it.
+func (repo *cachingRepository) fill(ctx context.Context, id uuid.UUID, user *UserEntity, ttl time.Duration, generation uint64) {
+	if repo.generation(id) != generation {
+		return
+	}
+	if err := repo.cache.Set(ctx, id, user, ttl); err != nil {
+		metrics.RepositoryCacheRequests.WithLabelValues("error").Inc()
+		slog.WarnContext(ctx, "could not write user to cache", "user_id", id, "error", err)
+		return
+	}
+	if repo.generation(id) != generation {
+		repo.delete(ctx, id)
+	}
+}
+
+func (repo *cachingRepository) invalidate(ctx context.Context, id uuid.UUID) {
+	// Counted before the eviction, so a fill either sees it or is evicted.
+	repo.generations[id[0]].Add(1)
+	repo.delete(ctx, id)
+}
+
+func (repo *cachingRepository) delete(ctx context.Context, id uuid.UUID) {
+	// The write is done, a canceled request must still evict the user.
+	ctx = context.WithoutCancel(ctx)
+	if err := repo.cache.Delete(ctx, id); err != nil {
+		metrics.RepositoryCacheRequests.WithLabelValues("error").Inc()
+		slog.ErrorContext(ctx, "could not invalidate cached user, it is stale until it expires", "user_id", id, "error", err)
+	}
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"backend-sample/common"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRepository serves the users of a map, counting the lookups by id.
+type countingRepository struct {
+	UsersRepository
+	mu      sync.Mutex
+	users   map[uuid.UUID]UserEntity
+	lookups atomic.Int32
+	batches atomic.Int32
+	// replicaReads counts the lookups that could be served by a replica.
+	replicaReads atomic.Int32
+	// release, when set, holds lookups until it is closed, started receiving each held lookup.
+	release chan struct{}
+	started chan struct{}
+}
+
+func (r *countingRepository) GetUserById(ctx context.Context, id uuid.UUID) (*UserEntity, *common.BackendError) {
+	r.lookups.Add(1)
+	r.countReplicaRead(ctx)
+	if r.release != nil {
+		r.started <- struct{}{}
+		<-r.release
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, common.NewBackendError(404, "GetUserById.3", "user not found for id %s", nil, id.String())
+	}
+	return &user, nil
+}
+
+func (r *countingRepository) GetUsersByIds(ctx context.Context, ids []uuid.UUID) (*[]UserEntity, *common.BackendError) {
+	r.batches.Add(1)
+	r.countReplicaRead(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := make([]UserEntity, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := r.users[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return &users, nil
+}
+
+func (r *countingRepository) UpdateUser(_ context.Context, user UserEntity) *common.BackendError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users[user.Id] = user
+	return nil
+}
+
+func (r *countingRepository) countReplicaRead(ctx context.Context) {
+	if primary, _ := ctx.Value(primaryKey{}).(bool); !primary {
+		r.replicaReads.Add(1)
+	}
+}
+
+func newCachingRepository(users ...UserEntity) (UsersRepository, *countingRepository) {
+	inner := &countingRepository{users: make(map[uuid.UUID]UserEntity)}
+	for _, user := range users {
+		inner.users[user.Id] = user
+	}
+	return NewCachingRepository(inner, newLRUCache(10), CacheConfiguration{}), inner
+}
+
+func Test_CachingRepository_GetUserById_ExpectCachedAndInvalidated(t *testing.T) {
+	ctx := context.Background()
+	john := UserEntity{Id: uuid.New(), Name: "John Doe"}
+	repo, inner := newCachingRepository(john)
+
+	user, berr := repo.GetUserById(ctx, john.Id)
+	assert.Nil(t, berr)
+	user.Name = "modified by the caller"
+	user, _ = repo.GetUserById(ctx, john.Id)
+	assert.Equal(t, "John Doe", user.Name)
+	assert.Equal(t, int32(1), inner.lookups.Load())
+
+	assert.Nil(t, repo.UpdateUser(ctx, UserEntity{Id: john.Id, Name: "Jane Doe"}))
+	user, _ = repo.GetUserById(ctx, john.Id)
+	assert.Equal(t, "Jane Doe", user.Name)
+	assert.Equal(t, int32(2), inner.lookups.Load())
+	assert.Equal(t, int32(0), inner.replicaReads.Load(), "the cache should be filled from the primary")
+}
+
+func Test_CachingRepository_NotFound_ExpectNegativeCaching(t *testing.T) {
+	repo, inner := newCachingRepository()
+	id := uuid.New()
+
+	for i := 0; i < 3; i++ {
+		_, berr := repo.GetUserById(context.Background(), id)
+		assert.Equal(t, 404, berr.Code)
+		assert.Equal(t, "GetUserById.3", berr.Identifier)
+	}
+	assert.Equal(t, int32(1), inner.lookups.Load())
+}
+
+func Test_CachingRepository_ConcurrentMisses_ExpectSingleLookup(t *testing.T) {
+	john := UserEntity{Id: uuid.New(), Name: "John Doe"}
+	repo, inner := newCachingRepository(john)
+	inner.release, inner.started = make(chan struct{}), make(chan struct{}, 10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, berr := repo.GetUserById(context.Background(), john.Id)
+			assert.Nil(t, berr)
+			assert.Equal(t, "John Doe", user.Name)
+		}()
+	}
+	// Goroutines arriving after the lookup ends find the user in the cache instead of joining it.
+	<-inner.started
+	close(inner.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), inner.lookups.Load())
+}
+
+func Test_CachingRepository_CallerCanceled_ExpectOthersServed(t *testing.T) {
+	john := UserEntity{Id: uuid.New(), Name: "John Doe"}
+	repo, inner := newCachingRepository(john)
+	inner.release, inner.started = make(chan struct{}), make(chan struct{}, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan *common.BackendError)
+	go func() {
+		_, berr := repo.GetUserById(ctx, john.Id)
+		canceled <- berr
+	}()
+	<-inner.started
+	cancel()
+	assert.Equal(t, 499, (<-canceled).Code)
+
+	close(inner.release)
+	user, berr := repo.GetUserById(context.Background(), john.Id)
+	assert.Nil(t, berr)
+	assert.Equal(t, "John Doe", user.Name)
+	assert.Equal(t, int32(1), inner.lookups.Load())
+}
+
+func Test_CachingRepository_GetUsersByIds_ExpectOnlyMissesQueried(t *testing.T) {
+	ctx := context.Background()
+	john, jane := UserEntity{Id: uuid.New(), Name: "John Doe"}, UserEntity{Id: uuid.New(), Name: "Jane Doe"}
+	unknown := uuid.New()
+	repo, inner := newCachingRepository(john, jane)
+	repo.GetUserById(ctx, john.Id)
+
+	users, berr := repo.GetUsersByIds(ctx, []uuid.UUID{john.Id, jane.Id, unknown})
+	assert.Nil(t, berr)
+	assert.Len(t, *users, 2)
+	assert.Equal(t, int32(1), inner.batches.Load())
+
+	users, _ = repo.GetUsersByIds(ctx, []uuid.UUID{jane.Id, unknown})
+	assert.Len(t, *users, 1)
+	assert.Equal(t, int32(1), inner.batches.Load(), "found and unknown users should both be cached")
+	assert.Equal(t, int32(0), inner.replicaReads.Load(), "the cache should be filled from the primary")
+}
+
+func Test_CachingRepository_UpdatedDuringLoad_ExpectStaleUserNotCached(t *testing.T) {
+	john := UserEntity{Id: uuid.New(), Name: "John Doe"}
+	repo, inner := newCachingRepository(john)
+	inner.release, inner.started = make(chan struct{}), make(chan struct{}, 10)
+
+	// The first load holds before its query, which may read the user as it was before the update.
+	earlier := make(chan *UserEntity)
+	go func() {
+		user, _ := repo.GetUserById(context.Background(), john.Id)
+		earlier <- user
+	}()
+	<-inner.started
+
+	assert.Nil(t, repo.UpdateUser(context.Background(), UserEntity{Id: john.Id, Name: "Jane Doe"}))
+
+	// The writer reads its own write instead of joining the load started before it.
+	fresh := make(chan *UserEntity)
+	go func() {
+		user, _ := repo.GetUserById(context.Background(), john.Id)
+		fresh <- user
+	}()
+	<-inner.started
+	close(inner.release)
+	<-earlier
+	assert.Equal(t, "Jane Doe", (<-fresh).Name)
+	assert.Equal(t, int32(2), inner.lookups.Load())
+
+	user, _ := repo.GetUserById(context.Background(), john.Id)
+	assert.Equal(t, "Jane Doe", user.Name)
+	assert.Equal(t, int32(2), inner.lookups.Load())
+}
+
+func Test_CachingRepository_FillRacingInvalidation_ExpectNotCached(t *testing.T) {
+	john := UserEntity{Id: uuid.New(), Name: "John Doe"}
+	repo, inner := newCachingRepository(john)
+	caching := repo.(*cachingRepository)
+
+	generation := caching.generation(john.Id)
+	caching.invalidate(context.Background(), john.Id)
+	caching.fill(context.Background(), john.Id, &john, time.Minute, generation)
+
+	repo.GetUserById(context.Background(), john.Id)
+	assert.Equal(t, int32(1), inner.lookups.Load(), "a user read before its invalidation should not be cached")
+}
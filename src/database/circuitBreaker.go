@@ -0,0 +1,207 @@
+package database
+
+import (
+	"backend-sample/metrics"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	DefaultCircuitFailureThreshold = 5
+	DefaultCircuitOpenTimeout      = 5 * time.Second
+	DefaultCircuitHalfOpenRequests = 1
+)
+
+type CircuitBreakerConfiguration struct {
+	// FailureThreshold is the number of consecutive failures opening the circuit, -1 disables it.
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"`
+	// OpenTimeout is how long queries fail fast before trial queries are let through.
+	OpenTimeout time.Duration `json:"openTimeout" yaml:"openTimeout"`
+	// HalfOpenRequests is the number of trial queries that must succeed to close the circuit again.
+	HalfOpenRequests int `json:"halfOpenRequests" yaml:"halfOpenRequests"`
+}
+
+func (c CircuitBreakerConfiguration) withDefaults() CircuitBreakerConfiguration {
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = DefaultCircuitFailureThreshold
+	}
+	if c.OpenTimeout == 0 {
+		c.OpenTimeout = DefaultCircuitOpenTimeout
+	}
+	if c.HalfOpenRequests == 0 {
+		c.HalfOpenRequests = DefaultCircuitHalfOpenRequests
+	}
+	return c
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitOpenError is returned without querying the database while the circuit is open.
+type CircuitOpenError struct {
+	// RetryAfter is the time left before the circuit lets trial queries through.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("database circuit is open, retry after %s", e.RetryAfter)
+}
+
+// circuitBreaker stops sending queries to a failing database so requests fail fast instead of
+// piling up on the pool. Closed lets everything through, open rejects everything until OpenTimeout
+// elapses, then half-open lets HalfOpenRequests trial queries through to decide whether to close.
+type circuitBreaker struct {
+	// pool names the connection pool the circuit protects, in logs and metrics.
+	pool      string
+	mu        sync.Mutex
+	state     circuitState
+	failures  int
+	openedAt  time.Time
+	trials    int
+	successes int
+}
+
+// allow reports whether a query may run, counting it as a trial while half-open.
+func (b *circuitBreaker) allow(config CircuitBreakerConfiguration, now time.Time) error {
+	if config.FailureThreshold < 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitOpen {
+		if elapsed := now.Sub(b.openedAt); elapsed < config.OpenTimeout {
+			return &CircuitOpenError{RetryAfter: config.OpenTimeout - elapsed}
+		}
+		b.setState(circuitHalfOpen)
+		b.trials, b.successes = 0, 0
+	}
+	if b.state == circuitHalfOpen {
+		if b.trials >= config.HalfOpenRequests {
+			return &CircuitOpenError{RetryAfter: config.OpenTimeout}
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// record updates the circuit with the outcome of an allowed query. Only failures of the database
+// itself count, not errors caused by the query such as duplicates. A query canceled by its client
+// says nothing of the database, it gives its trial back without changing the count.
+func (b *circuitBreaker) record(config CircuitBreakerConfiguration, err error, now time.Time) {
+	if config.FailureThreshold < 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case isUnavailable(err):
+		b.failures++
+		if b.state == circuitHalfOpen || b.failures >= config.FailureThreshold {
+			b.setState(circuitOpen)
+			b.openedAt = now
+		}
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// The request was canceled or ran out of its own time, e.g. the deadline of its route, which
+		// says nothing of the database.
+		if b.state == circuitHalfOpen && b.trials > 0 {
+			b.trials--
+		}
+	default:
+		b.failures = 0
+		if b.state == circuitHalfOpen {
+			b.successes++
+			if b.successes >= config.HalfOpenRequests {
+				b.setState(circuitClosed)
+			}
+		}
+	}
+}
+
+func (b *circuitBreaker) setState(state circuitState) {
+	if b.state == state {
+		return
+	}
+	slog.Warn("database circuit breaker changed state", "pool", b.pool, "from", b.state.String(), "to", state.String(), "failures", b.failures)
+	b.state = state
+	metrics.DatabaseCircuitState.WithLabelValues(b.pool).Set(float64(state))
+}
+
+// rejecting reports whether the circuit is open and still rejects every query.
+func (b *circuitBreaker) rejecting(config CircuitBreakerConfiguration, now time.Time) bool {
+	if config.FailureThreshold < 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == circuitOpen && now.Sub(b.openedAt) < config.OpenTimeout
+}
+
+// breakerOf returns the circuit breaker of the pool cn, each pool failing on its own: a replica
+// going down must not fail the writes of the primary, nor the primary the reads of the replicas.
+func (m *MySqlDatabaseService) breakerOf(cn *sql.DB) *circuitBreaker {
+	for _, r := range m.replicas {
+		if r.db == cn {
+			return &r.breaker
+		}
+	}
+	return &m.breaker
+}
+
+// CircuitBreakerPolicy returns the circuit breaker settings, defaults filled in.
+func (m *MySqlDatabaseService) CircuitBreakerPolicy() CircuitBreakerConfiguration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.Configuration.CircuitBreaker.withDefaults()
+}
+
+// SetCircuitBreakerPolicy changes the circuit breaker settings, keeping its current state.
+func (m *MySqlDatabaseService) SetCircuitBreakerPolicy(circuitBreaker CircuitBreakerConfiguration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Configuration.CircuitBreaker = circuitBreaker
+}
+
+// isUnavailable reports whether err means the database cannot serve queries at all. A hung
+// database is caught by the read and write timeouts of the connections, which fail as I/O errors.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == erConCount || mysqlErr.Number == erServerShutdown
+	}
+	return isConnectionError(err)
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCircuit = CircuitBreakerConfiguration{FailureThreshold: 2, OpenTimeout: time.Minute, HalfOpenRequests: 1}
+
+func Test_CircuitBreaker_ConsecutiveFailures_ExpectOpen(t *testing.T) {
+	var breaker circuitBreaker
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, breaker.allow(testCircuit, now))
+		breaker.record(testCircuit, driver.ErrBadConn, now)
+	}
+
+	var circuitErr *CircuitOpenError
+	assert.ErrorAs(t, breaker.allow(testCircuit, now.Add(10*time.Second)), &circuitErr)
+	assert.Equal(t, 50*time.Second, circuitErr.RetryAfter)
+}
+
+func Test_CircuitBreaker_QueryErrors_ExpectClosed(t *testing.T) {
+	var breaker circuitBreaker
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		breaker.record(testCircuit, &mysql.MySQLError{Number: 1062}, now)
+	}
+
+	assert.NoError(t, breaker.allow(testCircuit, now))
+}
+
+func Test_CircuitBreaker_HalfOpen_ExpectOneTrialThenClosed(t *testing.T) {
+	var breaker circuitBreaker
+	now := time.Now()
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+
+	later := now.Add(time.Minute)
+	assert.NoError(t, breaker.allow(testCircuit, later))
+	assert.Error(t, breaker.allow(testCircuit, later), "only one trial query is let through")
+
+	breaker.record(testCircuit, nil, later)
+	assert.Equal(t, circuitClosed, breaker.state)
+	assert.NoError(t, breaker.allow(testCircuit, later))
+}
+
+func Test_CircuitBreaker_HalfOpenFailure_ExpectOpenAgain(t *testing.T) {
+	var breaker circuitBreaker
+	now := time.Now()
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+
+	later := now.Add(time.Minute)
+	assert.NoError(t, breaker.allow(testCircuit, later))
+	breaker.record(testCircuit, driver.ErrBadConn, later)
+
+	assert.Error(t, breaker.allow(testCircuit, later.Add(time.Second)))
+}
+
+func Test_CircuitBreaker_ConnectionTimeouts_ExpectOpen(t *testing.T) {
+	var breaker circuitBreaker
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, breaker.allow(testCircuit, now))
+		breaker.record(testCircuit, &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, now)
+	}
+
+	assert.Equal(t, circuitOpen, breaker.state)
+	assert.Error(t, breaker.allow(testCircuit, now))
+}
+
+func Test_CircuitBreaker_RequestDeadlines_ExpectCountKept(t *testing.T) {
+	var breaker circuitBreaker
+	now := time.Now()
+
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+	for i := 0; i < 5; i++ {
+		breaker.record(testCircuit, errors.Join(context.DeadlineExceeded, errors.New("canceling query")), now)
+	}
+	assert.Equal(t, circuitClosed, breaker.state)
+
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+	assert.Equal(t, circuitOpen, breaker.state)
+}
+
+func Test_CircuitBreaker_Canceled_ExpectCountKept(t *testing.T) {
+	var breaker circuitBreaker
+	now := time.Now()
+
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+	breaker.record(testCircuit, context.Canceled, now)
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+
+	assert.Equal(t, circuitOpen, breaker.state)
+}
+
+func Test_CircuitBreaker_HalfOpenCanceled_ExpectTrialGivenBack(t *testing.T) {
+	var breaker circuitBreaker
+	now := time.Now()
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+	breaker.record(testCircuit, driver.ErrBadConn, now)
+
+	later := now.Add(time.Minute)
+	assert.NoError(t, breaker.allow(testCircuit, later))
+	breaker.record(testCircuit, context.Canceled, later)
+	assert.Equal(t, circuitHalfOpen, breaker.state)
+
+	assert.NoError(t, breaker.allow(testCircuit, later), "the canceled trial is given back")
+	breaker.record(testCircuit, driver.ErrBadConn, later)
+	assert.Equal(t, circuitOpen, breaker.state)
+}
+
+func Test_Execute_RequestDeadlines_ExpectCircuitClosed(t *testing.T) {
+	service := newRetryService(1)
+	service.SetCircuitBreakerPolicy(CircuitBreakerConfiguration{FailureThreshold: 2, OpenTimeout: time.Minute})
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	calls := 0
+	query := func() error {
+		calls++
+		return errors.New("canceling query due to timeout")
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, service.Execute(ctx, nil, "test", true, query), context.DeadlineExceeded)
+	}
+	err := service.Execute(context.Background(), nil, "test", true, func() error { calls++; return nil })
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, calls)
+}
+
+func Test_Execute_OpenCircuit_ExpectFailFastWith503(t *testing.T) {
+	service := newRetryService(1)
+	service.SetCircuitBreakerPolicy(CircuitBreakerConfiguration{FailureThreshold: 1, OpenTimeout: time.Minute})
+	calls := 0
+	query := func() error {
+		calls++
+		return driver.ErrBadConn
+	}
+
+	_ = service.Execute(context.Background(), nil, "test", true, query)
+	err := service.Execute(context.Background(), nil, "test", true, query)
+
+	var circuitErr *CircuitOpenError
+	assert.True(t, errors.As(err, &circuitErr))
+	assert.Equal(t, 1, calls)
+
+	berr := classifyError(err, nil)
+	assert.Equal(t, 503, berr.Code)
+	assert.Equal(t, "ClassifyError.6", berr.Identifier)
+	assert.Greater(t, berr.RetryAfter, time.Duration(0))
+}
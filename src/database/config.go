@@ -2,46 +2,182 @@ package database
 
 import (
 	"backend-sample/common"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
 type DatabaseConfiguration struct {
-	Host         string `json,yaml:host`
-	Database     string `json,yaml:database`
-	User         string `json,yaml:user`
-	Password     string `json,yaml:password`
-	Port         int    `json,yaml:port`
-	MaxLifetime  int    `json,yaml:maxLifetime`
-	MaxOpenConns int    `json,yaml:maxOpenConns`
-	MaxIdleConns int    `json,yaml:maxIdleConns`
+	Host     string `json:"host" yaml:"host"`
+	Database string `json:"database" yaml:"database"`
+	User     string `json:"user" yaml:"user"`
+	Password string `json:"password" yaml:"password"`
+	Port     int    `json:"port" yaml:"port"`
+	// MaxLifetime is a duration with a unit, e.g. "5m". Zero keeps connections forever.
+	MaxLifetime  time.Duration `json:"maxLifetime" yaml:"maxLifetime"`
+	MaxOpenConns int           `json:"maxOpenConns" yaml:"maxOpenConns"`
+	MaxIdleConns int           `json:"maxIdleConns" yaml:"maxIdleConns"`
+	// ConnectTimeout, ReadTimeout and WriteTimeout bound the dial and the I/O of each connection.
+	ConnectTimeout time.Duration `json:"connectTimeout" yaml:"connectTimeout"`
+	ReadTimeout    time.Duration `json:"readTimeout" yaml:"readTimeout"`
+	WriteTimeout   time.Duration `json:"writeTimeout" yaml:"writeTimeout"`
+	// Charset defaults to utf8mb4 and Collation to the server default of the charset.
+	Charset   string           `json:"charset" yaml:"charset"`
+	Collation string           `json:"collation" yaml:"collation"`
+	ParseTime bool             `json:"parseTime" yaml:"parseTime"`
+	TLS       TLSConfiguration `json:"tls" yaml:"tls"`
+	// StartupTimeout is how long WaitUntilReady waits for the database at startup.
+	StartupTimeout time.Duration `json:"startupTimeout" yaml:"startupTimeout"`
+	// Retry is the policy of transient failures, such as deadlocks and connections lost during a failover.
+	Retry RetryConfiguration `json:"retry" yaml:"retry"`
+	// CircuitBreaker makes queries fail fast while the database is unavailable.
+	CircuitBreaker CircuitBreakerConfiguration `json:"circuitBreaker" yaml:"circuitBreaker"`
+	// Replication routes reads to replicas of this primary.
+	Replication ReplicationConfiguration `json:"replication" yaml:"replication"`
 }
 
+// MySqlDatabaseService owns the connection pools of the primary and its replicas. It is created
+// once at startup with NewMySqlDatabaseService and shared by pointer, so every user gets the same pools.
 type MySqlDatabaseService struct {
 	Configuration DatabaseConfiguration
 	db            *sql.DB
+	mu            sync.Mutex
+	breaker       circuitBreaker
+	replicas      []*replica
+	nextReplica   atomic.Uint64
+	writes        writeTracker
+	statements    statementCache
 }
 
-func (m *MySqlDatabaseService) GetConnection() (*sql.DB, *common.BackendError) {
-	isEmpty := m.Configuration == DatabaseConfiguration{}
-	if isEmpty {
-		return nil, common.NewBackendError(500, "GetConnection.1", "database configuration is not initialized.", nil)
+// NewMySqlDatabaseService opens the connection pools of config. Connections are made on first use,
+// see WaitUntilReady to wait for the database to accept them.
+func NewMySqlDatabaseService(config DatabaseConfiguration) (*MySqlDatabaseService, *common.BackendError) {
+	if reflect.ValueOf(config).IsZero() {
+		return nil, common.NewBackendError(503, "NewMySqlDatabaseService.1", "database configuration is not initialized.", nil)
 	}
 
-	if m.db == nil {
-		var err error
-		m.db, err = sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?tls=skip-verify&autocommit=true", m.Configuration.User, m.Configuration.Password, m.Configuration.Host, m.Configuration.Port, m.Configuration.Database))
+	db, err := openPool(config, config.Host, config.Port)
+	if err != nil {
+		return nil, common.NewBackendError(503, "NewMySqlDatabaseService.2", "could not open connection to host %s", err, config.Host)
+	}
+
+	replicas := make([]*replica, 0, len(config.Replication.Replicas))
+	for _, replicaConfig := range config.Replication.Replicas {
+		replicaDb, err := openPool(config, replicaConfig.Host, replicaConfig.Port)
 		if err != nil {
-			return nil, common.NewBackendError(500, "GetConnection.2", "could not open connection to host %s", err, m.Configuration.Host)
+			db.Close()
+			for _, opened := range replicas {
+				opened.db.Close()
+			}
+			return nil, common.NewBackendError(503, "NewMySqlDatabaseService.3", "could not open connection to replica %s", err, replicaConfig.Host)
 		}
+
+		name := net.JoinHostPort(replicaConfig.Host, strconv.Itoa(replicaConfig.Port))
+		r := &replica{name: name, db: replicaDb, breaker: circuitBreaker{pool: name}}
+		r.healthy.Store(true)
+		replicas = append(replicas, r)
 	}
 
-	m.db.SetConnMaxLifetime(time.Duration(m.Configuration.MaxLifetime))
-	m.db.SetMaxOpenConns(m.Configuration.MaxOpenConns)
-	m.db.SetMaxIdleConns(m.Configuration.MaxIdleConns)
+	return &MySqlDatabaseService{Configuration: config, db: db, breaker: circuitBreaker{pool: "primary"}, replicas: replicas}, nil
+}
 
+// GetConnection returns the connection pool of the primary.
+func (m *MySqlDatabaseService) GetConnection() (*sql.DB, *common.BackendError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		return nil, common.NewBackendError(503, "GetConnection.1", "database configuration is not initialized.", nil)
+	}
 	return m.db, nil
 }
+
+// WaitUntilReady pings the primary with exponential backoff until it answers or ctx is done,
+// so the service does not start serving before its database.
+func (m *MySqlDatabaseService) WaitUntilReady(ctx context.Context) error {
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := m.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+
+		slog.WarnContext(ctx, "database is not ready", "attempt", attempt, "backoff", backoff, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("database not ready: %w", err)
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, 5*time.Second)
+	}
+}
+
+// Stats returns the statistics of the connection pool, or zero values while it is not open.
+func (m *MySqlDatabaseService) Stats() sql.DBStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.db == nil {
+		return sql.DBStats{}
+	}
+	return m.db.Stats()
+}
+
+// Ping checks that the database is reachable, for readiness probes.
+func (m *MySqlDatabaseService) Ping(ctx context.Context) error {
+	cn, berr := m.GetConnection()
+	if berr != nil {
+		return berr
+	}
+	return cn.PingContext(ctx)
+}
+
+// Close closes the connection pools. In-flight queries finish before it returns.
+func (m *MySqlDatabaseService) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := []error{m.statements.close()}
+	for _, r := range m.replicas {
+		errs = append(errs, r.db.Close())
+	}
+
+	if m.db != nil {
+		errs = append(errs, m.db.Close())
+		m.db = nil
+	}
+	return errors.Join(errs...)
+}
+
+// SetPoolSettings changes the pool limits, applying them to the open pools right away.
+func (m *MySqlDatabaseService) SetPoolSettings(maxOpenConns, maxIdleConns int, maxLifetime time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Configuration.MaxOpenConns = maxOpenConns
+	m.Configuration.MaxIdleConns = maxIdleConns
+	m.Configuration.MaxLifetime = maxLifetime
+
+	pools := make([]*sql.DB, 0, len(m.replicas)+1)
+	if m.db != nil {
+		pools = append(pools, m.db)
+	}
+	for _, r := range m.replicas {
+		pools = append(pools, r.db)
+	}
+	for _, pool := range pools {
+		pool.SetConnMaxLifetime(maxLifetime)
+		pool.SetMaxOpenConns(maxOpenConns)
+		pool.SetMaxIdleConns(maxIdleConns)
+	}
+}
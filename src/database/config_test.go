@@ -1,46 +1,25 @@
 package database
 
 import (
-	"database/sql"
-	"os"
+	"context"
 	"testing"
+	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 )
 
-type MockDatabase struct {
-}
-
 var dbConfig = DatabaseConfiguration{
 	Host:         "host",
 	Database:     "database",
 	User:         "user",
 	Password:     "password",
 	Port:         3306,
-	MaxLifetime:  10,
+	MaxLifetime:  10 * time.Second,
 	MaxOpenConns: 100,
 	MaxIdleConns: 10,
 }
 
-var cn *sql.DB
-var mock sqlmock.Sqlmock
-
-func TestMain_Config(m *testing.M) {
-	var err error
-	cn, mock, err = sqlmock.New()
-
-	if err != nil {
-		panic(err)
-	}
-
-	// Setup code before running tests
-	code := m.Run()
-
-	// Teardown code after running tests
-	os.Exit(code)
-}
-func Test_GetConnection_ExpectSucces(t *testing.T) {
+func Test_NewMySqlDatabaseService_InvalidConfiguration_ExpectError(t *testing.T) {
 	tests := []struct {
 		name           string
 		config         DatabaseConfiguration
@@ -59,21 +38,27 @@ func Test_GetConnection_ExpectSucces(t *testing.T) {
 				User:         "user",
 				Password:     "password",
 				Port:         3306,
-				MaxLifetime:  10,
+				MaxLifetime:  10 * time.Second,
 				MaxOpenConns: 100,
 				MaxIdleConns: 10,
 			},
 			expectedErrMsg: "could not open connection to host invalid_host",
 		},
+		{
+			name:           "Unknown TLS mode",
+			config:         withTLS(dbConfig, TLSConfiguration{Mode: "always"}),
+			expectedErrMsg: `unknown tls mode "always"`,
+		},
+		{
+			name:           "Missing CA file",
+			config:         withTLS(dbConfig, TLSConfiguration{CAFile: "missing-ca.pem"}),
+			expectedErrMsg: "reading tls.caFile",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db := &MySqlDatabaseService{
-				Configuration: tt.config,
-			}
-
-			_, err := db.GetConnection()
+			_, err := NewMySqlDatabaseService(tt.config)
 			if err == nil {
 				t.Fatalf("expected an error but got nil")
 			}
@@ -83,12 +68,62 @@ func Test_GetConnection_ExpectSucces(t *testing.T) {
 	}
 }
 
-func Test_GetConnection_ExpectSuccess(t *testing.T) {
-	db := &MySqlDatabaseService{
-		Configuration: dbConfig,
-	}
+func withTLS(config DatabaseConfiguration, tls TLSConfiguration) DatabaseConfiguration {
+	config.TLS = tls
+	return config
+}
 
-	conn, err := db.GetConnection()
-	assert.NoError(t, err)
+func Test_NewMySqlDatabaseService_ExpectSuccess(t *testing.T) {
+	db, berr := NewMySqlDatabaseService(dbConfig)
+	assert.Nil(t, berr)
+	defer db.Close()
+
+	conn, berr := db.GetConnection()
+	assert.Nil(t, berr)
 	assert.NotNil(t, conn)
+	assert.Equal(t, 100, conn.Stats().MaxOpenConnections)
+}
+
+func Test_GetConnection_AfterClose_ExpectError(t *testing.T) {
+	db, berr := NewMySqlDatabaseService(dbConfig)
+	assert.Nil(t, berr)
+	assert.NoError(t, db.Close())
+
+	_, berr = db.GetConnection()
+	assert.NotNil(t, berr)
+}
+
+func Test_ConnectorConfiguration_ExpectOptionsFromConfig(t *testing.T) {
+	config := dbConfig
+	config.Password = "p@ss/word?"
+	config.ConnectTimeout = 3 * time.Second
+	config.ParseTime = true
+	config.Collation = "utf8mb4_unicode_ci"
+	config.TLS.Mode = TLSModeSkipVerify
+
+	connectorConfig, err := connectorConfiguration(config, "db.internal", 3307)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "db.internal:3307", connectorConfig.Addr)
+	assert.Equal(t, "p@ss/word?", connectorConfig.Passwd)
+	assert.Equal(t, 3*time.Second, connectorConfig.Timeout)
+	assert.True(t, connectorConfig.ParseTime)
+	assert.Equal(t, "utf8mb4_unicode_ci", connectorConfig.Collation)
+	assert.Equal(t, "utf8mb4", connectorConfig.Params["charset"])
+	assert.Equal(t, "skip-verify", connectorConfig.TLSConfig)
+}
+
+func Test_WaitUntilReady_Unreachable_ExpectTimeout(t *testing.T) {
+	config := dbConfig
+	config.Host = "127.0.0.1"
+	config.Port = 1
+	config.TLS.Mode = TLSModeDisabled
+	db, berr := NewMySqlDatabaseService(config)
+	assert.Nil(t, berr)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	assert.Error(t, db.WaitUntilReady(ctx))
 }
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	TLSModeVerify     = "verify"
+	TLSModeSkipVerify = "skip-verify"
+	TLSModePreferred  = "preferred"
+	TLSModeDisabled   = "disabled"
+
+	DefaultCharset = "utf8mb4"
+)
+
+type TLSConfiguration struct {
+	// Mode is verify by default, checking the server certificate against CAFile or the system roots.
+	// skip-verify encrypts without checking it, preferred falls back to plaintext and disabled never encrypts.
+	Mode       string `json:"mode" yaml:"mode"`
+	CAFile     string `json:"caFile" yaml:"caFile"`
+	CertFile   string `json:"certFile" yaml:"certFile"`
+	KeyFile    string `json:"keyFile" yaml:"keyFile"`
+	ServerName string `json:"serverName" yaml:"serverName"`
+}
+
+// hostnamePattern accepts RFC 1123 host names, IP addresses are checked apart.
+var hostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// ValidateHost checks that host is an IP address or a valid host name.
+func ValidateHost(host string) error {
+	if net.ParseIP(host) != nil || (len(host) <= 253 && hostnamePattern.MatchString(host)) {
+		return nil
+	}
+	return fmt.Errorf("invalid host %q", host)
+}
+
+// openPool opens the connection pool of host, the primary or a replica, with the connection
+// options and pool limits of config. No connection is made until the pool is used.
+func openPool(config DatabaseConfiguration, host string, port int) (*sql.DB, error) {
+	connectorConfig, err := connectorConfiguration(config, host, port)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(connectorConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(connector)
+	db.SetConnMaxLifetime(config.MaxLifetime)
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	return db, nil
+}
+
+// connectorConfiguration builds the driver options of host instead of formatting a DSN, so
+// credentials need no escaping.
+func connectorConfiguration(config DatabaseConfiguration, host string, port int) (*mysql.Config, error) {
+	if err := ValidateHost(host); err != nil {
+		return nil, err
+	}
+
+	connectorConfig := mysql.NewConfig()
+	connectorConfig.User = config.User
+	connectorConfig.Passwd = config.Password
+	connectorConfig.Net = "tcp"
+	connectorConfig.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	connectorConfig.DBName = config.Database
+	connectorConfig.Timeout = config.ConnectTimeout
+	connectorConfig.ReadTimeout = config.ReadTimeout
+	connectorConfig.WriteTimeout = config.WriteTimeout
+	connectorConfig.ParseTime = config.ParseTime
+	connectorConfig.Collation = config.Collation
+
+	charset := config.Charset
+	if charset == "" {
+		charset = DefaultCharset
+	}
+	connectorConfig.Params = map[string]string{"charset": charset, "autocommit": "true"}
+
+	switch strings.ToLower(config.TLS.Mode) {
+	case "", TLSModeVerify:
+		tlsConfig, err := loadTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		connectorConfig.TLS = tlsConfig
+	case TLSModeSkipVerify:
+		connectorConfig.TLSConfig = "skip-verify"
+	case TLSModePreferred:
+		connectorConfig.TLSConfig = "preferred"
+	case TLSModeDisabled:
+		connectorConfig.TLSConfig = "false"
+	default:
+		return nil, fmt.Errorf("unknown tls mode %q, expected %s, %s, %s or %s", config.TLS.Mode, TLSModeVerify, TLSModeSkipVerify, TLSModePreferred, TLSModeDisabled)
+	}
+
+	return connectorConfig, nil
+}
+
+func loadTLSConfig(config TLSConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: config.ServerName, MinVersion: tls.VersionTLS12}
+
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading tls.caFile: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls.caFile %s has no PEM certificate", config.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("tls.certFile and tls.keyFile must be set together")
+	}
+	if config.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading the tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"backend-sample/common"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL server error numbers, see https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html.
+const (
+	erConCount        = 1040
+	erServerShutdown  = 1053
+	erDupEntry        = 1062
+	erLockWaitTimeout = 1205
+	erLockDeadlock    = 1213
+	erDataTooLong     = 1406
+)
+
+// userEmailIndexKey is the unique key keeping two users from registering the same normalized email.
+const userEmailIndexKey = "user_email_index"
+
+var (
+	duplicateKeyPattern = regexp.MustCompile(`for key '([^']+)'`)
+	columnPattern       = regexp.MustCompile(`for column '([^']+)'`)
+)
+
+// classifyError maps the MySQL errors a client can act on to their own BackendError, a conflict,
+// an invalid value or a database to retry later, and canceled or timed out requests to 499 and 504.
+// Other errors return fallback, the error of the failed operation.
+func classifyError(err error, fallback *common.BackendError) *common.BackendError {
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return common.NewBackendError(503, "ClassifyError.6", "database is unavailable, try again later", err).WithRetryAfter(circuitErr.RetryAfter)
+	}
+
+	// Checked first, the driver may wrap them in connection errors.
+	if errors.Is(err, context.Canceled) {
+		return common.NewBackendError(499, "ClassifyError.7", "request canceled by the client", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return common.NewBackendError(504, "ClassifyError.8", "request timed out", err)
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case erDupEntry:
+			key := submatch(duplicateKeyPattern, mysqlErr.Message)
+			if key == userEmailIndexKey || strings.HasSuffix(key, "."+userEmailIndexKey) {
+				return common.NewBackendError(409, "ClassifyError.1", "email already registered", err)
+			}
+			return common.NewBackendError(409, "ClassifyError.2", "duplicate value for key %s", err, key)
+		case erDataTooLong:
+			return common.NewBackendError(400, "ClassifyError.3", "value too long for %s", err, submatch(columnPattern, mysqlErr.Message))
+		case erLockDeadlock, erLockWaitTimeout:
+			return common.NewBackendError(503, "ClassifyError.4", "database is busy, try again later", err)
+		case erConCount, erServerShutdown:
+			return common.NewBackendError(503, "ClassifyError.5", "database is unavailable", err)
+		}
+		return fallback
+	}
+
+	if isConnectionError(err) {
+		return common.NewBackendError(503, "ClassifyError.5", "database is unavailable", err)
+	}
+	return fallback
+}
+
+// isConnectionError reports whether err comes from a lost or unreachable connection, not from the query.
+// Context errors are excluded, context.DeadlineExceeded is a net.Error but retrying it cannot help.
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.As(err, &netErr)
+}
+
+func submatch(pattern *regexp.Regexp, message string) string {
+	if match := pattern.FindStringSubmatch(message); match != nil {
+		return match[1]
+	}
+	return ""
+}
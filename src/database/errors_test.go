@@ -0,0 +1,51 @@
+package database
+
+import (
+	"backend-sample/common"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ClassifyError_ExpectTypedErrors(t *testing.T) {
+	fallback := common.NewBackendError(500, "CreateUser.2", "could not insert user", nil)
+
+	tests := map[string]struct {
+		err        error
+		identifier string
+		code       int
+	}{
+		"duplicate email": {&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'x' for key 'user.user_email_index'"}, "ClassifyError.1", 409},
+		"duplicate key":   {&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'x' for key 'PRIMARY'"}, "ClassifyError.2", 409},
+		"data too long":   {&mysql.MySQLError{Number: 1406, Message: "Data too long for column 'name' at row 1"}, "ClassifyError.3", 400},
+		"deadlock":        {&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}, "ClassifyError.4", 503},
+		"lock timeout":    {fmt.Errorf("exec: %w", &mysql.MySQLError{Number: 1205}), "ClassifyError.4", 503},
+		"too many conns":  {&mysql.MySQLError{Number: 1040}, "ClassifyError.5", 503},
+		"bad connection":  {driver.ErrBadConn, "ClassifyError.5", 503},
+		"invalid conn":    {mysql.ErrInvalidConn, "ClassifyError.5", 503},
+		"network":         {&net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")}, "ClassifyError.5", 503},
+		"canceled":        {fmt.Errorf("query: %w", context.Canceled), "ClassifyError.7", 499},
+		"deadline":        {context.DeadlineExceeded, "ClassifyError.8", 504},
+		"other mysql":     {&mysql.MySQLError{Number: 1146, Message: "Table doesn't exist"}, "CreateUser.2", 500},
+		"other error":     {fmt.Errorf("boom"), "CreateUser.2", 500},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			berr := classifyError(test.err, fallback)
+
+			assert.Equal(t, test.identifier, berr.Identifier)
+			assert.Equal(t, test.code, berr.Code)
+		})
+	}
+}
+
+func Test_ClassifyError_DataTooLong_ExpectColumnInMessage(t *testing.T) {
+	berr := classifyError(&mysql.MySQLError{Number: 1406, Message: "Data too long for column 'name' at row 1"}, nil)
+
+	assert.Equal(t, "value too long for name", berr.Message)
+}
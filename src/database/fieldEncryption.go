@@ -0,0 +1,113 @@
+package database
+
+import (
+	"backend-sample/common"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+type FieldEncryptionConfiguration struct {
+	ActiveKey string                    `json:"activeKey" yaml:"activeKey"`
+	Keys      []common.KeyConfiguration `json:"keys" yaml:"keys"`
+	// IndexKey is the HMAC key of blind indexes. Changing it requires recomputing every index.
+	IndexKey string `json:"indexKey" yaml:"indexKey"`
+}
+
+var errFieldEncryptionNotInitialized = errors.New("field encryption is not initialized")
+
+// FieldEncryptor encrypts columns holding personal data and computes their blind indexes,
+// keyed hashes that allow exact lookups and unique constraints without decrypting.
+type FieldEncryptor struct {
+	state atomic.Pointer[fieldEncryptorState]
+}
+
+type fieldEncryptorState struct {
+	keyring  *common.Keyring
+	indexKey []byte
+}
+
+func NewFieldEncryptor(config FieldEncryptionConfiguration) (*FieldEncryptor, error) {
+	encryptor := &FieldEncryptor{}
+	if err := encryptor.Update(config); err != nil {
+		return nil, err
+	}
+	return encryptor, nil
+}
+
+// Update replaces the keys, e.g. after a configuration reload. Values encrypted with keys no longer
+// configured cannot be read anymore.
+func (e *FieldEncryptor) Update(config FieldEncryptionConfiguration) error {
+	var errs []error
+	keyring, err := common.NewKeyring(common.KeyringConfiguration{ActiveKey: config.ActiveKey, Keys: config.Keys})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	indexKey, err := common.DecodeBase64(config.IndexKey)
+	if err != nil || len(indexKey) != common.KeySize {
+		errs = append(errs, fmt.Errorf("indexKey must be a base64 key of %d bytes", common.KeySize))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	e.state.Store(&fieldEncryptorState{keyring: keyring, indexKey: indexKey})
+	return nil
+}
+
+func (e *FieldEncryptor) current() (*fieldEncryptorState, error) {
+	if e == nil || e.state.Load() == nil {
+		return nil, errFieldEncryptionNotInitialized
+	}
+	return e.state.Load(), nil
+}
+
+// ActiveKey returns the id of the key new values are encrypted with.
+func (e *FieldEncryptor) ActiveKey() string {
+	state, err := e.current()
+	if err != nil {
+		return ""
+	}
+	return state.keyring.ActiveKey()
+}
+
+// Encrypt encrypts the value of column for the row id. The ciphertext is bound to both,
+// so it cannot be copied to another column or row.
+func (e *FieldEncryptor) Encrypt(column string, id uuid.UUID, value string) (string, error) {
+	state, err := e.current()
+	if err != nil {
+		return "", err
+	}
+	return state.keyring.Encrypt(value, fieldAssociatedData(column, id))
+}
+
+func (e *FieldEncryptor) Decrypt(column string, id uuid.UUID, value string) (string, error) {
+	state, err := e.current()
+	if err != nil {
+		return "", err
+	}
+	plaintext, _, err := state.keyring.Decrypt(value, fieldAssociatedData(column, id))
+	return plaintext, err
+}
+
+// BlindIndex returns the HMAC-SHA256 of the value of column. Values must be normalized by the
+// caller, as only identical values share an index.
+func (e *FieldEncryptor) BlindIndex(column, value string) ([]byte, error) {
+	state, err := e.current()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, state.indexKey)
+	mac.Write([]byte(column))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil), nil
+}
+
+func fieldAssociatedData(column string, id uuid.UUID) []byte {
+	return append([]byte(column+"/"), id[:]...)
+}
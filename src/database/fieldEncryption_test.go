@@ -0,0 +1,61 @@
+package database
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func Test_FieldEncryptor_Rotation_ExpectOldValuesDecrypted(t *testing.T) {
+	encryptor, err := NewFieldEncryptor(testFieldEncryption)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	id := uuid.New()
+	encrypted, err := encryptor.Encrypt(userEmailColumn, id, "john@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	index, _ := encryptor.BlindIndex(userEmailColumn, "john@example.com")
+
+	rotated := testFieldEncryption
+	rotated.ActiveKey = "v2"
+	rotated.Keys = append(rotated.Keys, testFieldEncryption.Keys[0])
+	rotated.Keys[1].Id = "v2"
+	rotated.Keys[1].Value = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	if err := encryptor.Update(rotated); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if email, err := encryptor.Decrypt(userEmailColumn, id, encrypted); err != nil || email != "john@example.com" {
+		t.Errorf("expected the email encrypted before rotation, got '%s', %v", email, err)
+	}
+	if encryptor.ActiveKey() != "v2" {
+		t.Errorf("expected active key v2, got %s", encryptor.ActiveKey())
+	}
+	if rotatedIndex, _ := encryptor.BlindIndex(userEmailColumn, "john@example.com"); !bytes.Equal(index, rotatedIndex) {
+		t.Errorf("expected the blind index to survive key rotation")
+	}
+}
+
+func Test_FieldEncryptor_Update_InvalidConfiguration_KeepsKeys(t *testing.T) {
+	encryptor, _ := NewFieldEncryptor(testFieldEncryption)
+
+	if err := encryptor.Update(FieldEncryptionConfiguration{ActiveKey: "v1"}); err == nil {
+		t.Errorf("expected an error for a configuration without keys")
+	}
+
+	if _, err := encryptor.Encrypt(userEmailColumn, uuid.New(), "john@example.com"); err != nil {
+		t.Errorf("expected the previous keys to be kept, got %s", err)
+	}
+}
+
+func Test_FieldEncryptor_NotInitialized_ExpectError(t *testing.T) {
+	var encryptor *FieldEncryptor
+
+	if _, err := encryptor.Encrypt(userEmailColumn, uuid.New(), "john@example.com"); err != errFieldEncryptionNotInitialized {
+		t.Errorf("expected errFieldEncryptionNotInitialized, got %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dialect renders the placeholders and quoted identifiers of a database.
+type Dialect int
+
+const (
+	MySQL Dialect = iota
+	PostgreSQL
+	SQLite
+)
+
+func (d Dialect) placeholder(position int) string {
+	if d == PostgreSQL {
+		return "$" + strconv.Itoa(position)
+	}
+	return "?"
+}
+
+func (d Dialect) quote(identifier string) string {
+	quote := `"`
+	if d == MySQL {
+		quote = "`"
+	}
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = quote + part + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+// Column names a column, optionally qualified by its table as in user.name. Column names are
+// checked when the query is built, they are the only part of the SQL not sent as an argument.
+type Column string
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Condition is a boolean expression of a WHERE clause. Its values are always sent as arguments.
+type Condition interface {
+	write(w *queryWriter)
+}
+
+// queryWriter accumulates the SQL and arguments of a query, keeping the first error.
+type queryWriter struct {
+	dialect Dialect
+	sql     strings.Builder
+	args    []any
+	err     error
+}
+
+func (w *queryWriter) identifier(name string) {
+	if !identifierPattern.MatchString(name) {
+		if w.err == nil {
+			w.err = fmt.Errorf("invalid identifier %q", name)
+		}
+		return
+	}
+	w.sql.WriteString(w.dialect.quote(name))
+}
+
+func (w *queryWriter) value(value any) {
+	w.args = append(w.args, value)
+	w.sql.WriteString(w.dialect.placeholder(len(w.args)))
+}
+
+type comparison struct {
+	column   Column
+	operator string
+	value    any
+}
+
+func (c comparison) write(w *queryWriter) {
+	w.identifier(string(c.column))
+	w.sql.WriteString(" " + c.operator + " ")
+	w.value(c.value)
+}
+
+func Eq(column Column, value any) Condition    { return comparison{column, "=", value} }
+func NotEq(column Column, value any) Condition { return comparison{column, "<>", value} }
+func Gt(column Column, value any) Condition    { return comparison{column, ">", value} }
+func Gte(column Column, value any) Condition   { return comparison{column, ">=", value} }
+func Lt(column Column, value any) Condition    { return comparison{column, "<", value} }
+func Lte(column Column, value any) Condition   { return comparison{column, "<=", value} }
+
+// Like matches pattern, whose % and _ are wildcards.
+func Like(column Column, pattern string) Condition { return comparison{column, "LIKE", pattern} }
+
+type between struct {
+	column    Column
+	low, high any
+}
+
+// Between matches the values from low to high, both included.
+func Between(column Column, low, high any) Condition { return between{column, low, high} }
+
+func (b between) write(w *queryWriter) {
+	w.identifier(string(b.column))
+	w.sql.WriteString(" BETWEEN ")
+	w.value(b.low)
+	w.sql.WriteString(" AND ")
+	w.value(b.high)
+}
+
+type in struct {
+	column Column
+	values []any
+}
+
+// In matches any of values. Without values it matches nothing.
+func In(column Column, values ...any) Condition { return in{column, values} }
+
+func (c in) write(w *queryWriter) {
+	if len(c.values) == 0 {
+		w.sql.WriteString("1 = 0")
+		return
+	}
+	w.identifier(string(c.column))
+	w.sql.WriteString(" IN (")
+	for i, value := range c.values {
+		if i > 0 {
+			w.sql.WriteString(", ")
+		}
+		w.value(value)
+	}
+	w.sql.WriteString(")")
+}
+
+type isNull struct {
+	column Column
+	not    bool
+}
+
+func IsNull(column Column) Condition    { return isNull{column, false} }
+func IsNotNull(column Column) Condition { return isNull{column, true} }
+
+func (c isNull) write(w *queryWriter) {
+	w.identifier(string(c.column))
+	if c.not {
+		w.sql.WriteString(" IS NOT NULL")
+	} else {
+		w.sql.WriteString(" IS NULL")
+	}
+}
+
+type group struct {
+	operator   string
+	conditions []Condition
+}
+
+// And matches when every condition does, nil conditions are skipped so optional filters can be
+// passed as is. Without conditions it matches everything.
+func And(conditions ...Condition) Condition { return group{"AND", conditions} }
+
+// Or matches when any condition does, nil conditions are skipped. Without conditions it matches nothing.
+func Or(conditions ...Condition) Condition { return group{"OR", conditions} }
+
+func (g group) write(w *queryWriter) {
+	conditions := make([]Condition, 0, len(g.conditions))
+	for _, condition := range g.conditions {
+		if condition != nil {
+			conditions = append(conditions, condition)
+		}
+	}
+
+	switch {
+	case len(conditions) == 0 && g.operator == "AND":
+		w.sql.WriteString("1 = 1")
+	case len(conditions) == 0:
+		w.sql.WriteString("1 = 0")
+	case len(conditions) == 1:
+		conditions[0].write(w)
+	default:
+		w.sql.WriteString("(")
+		for i, condition := range conditions {
+			if i > 0 {
+				w.sql.WriteString(" " + g.operator + " ")
+			}
+			condition.write(w)
+		}
+		w.sql.WriteString(")")
+	}
+}
+
+type not struct {
+	condition Condition
+}
+
+// Not negates condition. A nil condition stays nil, so it is skipped like the other optional filters.
+func Not(condition Condition) Condition {
+	if condition == nil {
+		return nil
+	}
+	return not{condition}
+}
+
+func (n not) write(w *queryWriter) {
+	w.sql.WriteString("NOT (")
+	n.condition.write(w)
+	w.sql.WriteString(")")
+}
+
+// Direction is the sort order of an ORDER BY column.
+type Direction string
+
+const (
+	Ascending  Direction = "ASC"
+	Descending Direction = "DESC"
+)
+
+type ordering struct {
+	column    Column
+	direction Direction
+}
+
+// SelectBuilder builds a SELECT query. Build it with Select(...).From(...), the other clauses are optional.
+type SelectBuilder struct {
+	columns []Column
+	table   string
+	where   Condition
+	orderBy []ordering
+	limit   *int
+	offset  *int
+}
+
+func Select(columns ...Column) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+func (b *SelectBuilder) From(table string) *SelectBuilder {
+	b.table = table
+	return b
+}
+
+// Where sets the condition of the rows, combine several with And or Or.
+func (b *SelectBuilder) Where(condition Condition) *SelectBuilder {
+	b.where = condition
+	return b
+}
+
+func (b *SelectBuilder) OrderBy(column Column, direction Direction) *SelectBuilder {
+	b.orderBy = append(b.orderBy, ordering{column, direction})
+	return b
+}
+
+func (b *SelectBuilder) Limit(limit int) *SelectBuilder {
+	b.limit = &limit
+	return b
+}
+
+// Offset skips the first rows, it requires a limit.
+func (b *SelectBuilder) Offset(offset int) *SelectBuilder {
+	b.offset = &offset
+	return b
+}
+
+// Build returns the SQL of the query for dialect and its arguments, in placeholder order.
+func (b *SelectBuilder) Build(dialect Dialect) (string, []any, error) {
+	if len(b.columns) == 0 || b.table == "" {
+		return "", nil, errors.New("a select needs columns and a table")
+	}
+	if b.offset != nil && b.limit == nil {
+		return "", nil, errors.New("an offset requires a limit")
+	}
+
+	w := &queryWriter{dialect: dialect}
+	w.sql.WriteString("SELECT ")
+	for i, column := range b.columns {
+		if i > 0 {
+			w.sql.WriteString(", ")
+		}
+		w.identifier(string(column))
+	}
+	w.sql.WriteString(" FROM ")
+	w.identifier(b.table)
+
+	if b.where != nil {
+		w.sql.WriteString(" WHERE ")
+		b.where.write(w)
+	}
+
+	for i, order := range b.orderBy {
+		if i == 0 {
+			w.sql.WriteString(" ORDER BY ")
+		} else {
+			w.sql.WriteString(", ")
+		}
+		if order.direction != Ascending && order.direction != Descending {
+			return "", nil, fmt.Errorf("invalid direction %q", order.direction)
+		}
+		w.identifier(string(order.column))
+		w.sql.WriteString(" " + string(order.direction))
+	}
+
+	if b.limit != nil {
+		w.sql.WriteString(" LIMIT ")
+		w.value(*b.limit)
+	}
+	if b.offset != nil {
+		w.sql.WriteString(" OFFSET ")
+		w.value(*b.offset)
+	}
+
+	if w.err != nil {
+		return "", nil, w.err
+	}
+	return w.sql.String(), w.args, nil
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SelectBuilder_ExpectDialectSQL(t *testing.T) {
+	query := Select("user_id", "name").From("user").
+		Where(And(
+			Or(Eq("name", "John"), Like("name", "Ja%")),
+			Not(In("user_id", 1, 2)),
+			Between("created_at", "2024-01-01", "2024-12-31"),
+			IsNotNull("email"),
+		)).
+		OrderBy("name", Ascending).
+		OrderBy("user.user_id", Descending).
+		Limit(10).
+		Offset(20)
+
+	tests := map[Dialect]string{
+		MySQL: "SELECT `user_id`, `name` FROM `user` WHERE ((`name` = ? OR `name` LIKE ?) AND NOT (`user_id` IN (?, ?)) AND " +
+			"`created_at` BETWEEN ? AND ? AND `email` IS NOT NULL) ORDER BY `name` ASC, `user`.`user_id` DESC LIMIT ? OFFSET ?",
+		PostgreSQL: `SELECT "user_id", "name" FROM "user" WHERE (("name" = $1 OR "name" LIKE $2) AND NOT ("user_id" IN ($3, $4)) AND ` +
+			`"created_at" BETWEEN $5 AND $6 AND "email" IS NOT NULL) ORDER BY "name" ASC, "user"."user_id" DESC LIMIT $7 OFFSET $8`,
+		SQLite: `SELECT "user_id", "name" FROM "user" WHERE (("name" = ? OR "name" LIKE ?) AND NOT ("user_id" IN (?, ?)) AND ` +
+			`"created_at" BETWEEN ? AND ? AND "email" IS NOT NULL) ORDER BY "name" ASC, "user"."user_id" DESC LIMIT ? OFFSET ?`,
+	}
+	for dialect, expected := range tests {
+		sql, args, err := query.Build(dialect)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expected, sql)
+		assert.Equal(t, []any{"John", "Ja%", 1, 2, "2024-01-01", "2024-12-31", 10, 20}, args)
+	}
+}
+
+func Test_SelectBuilder_EmptyGroups_ExpectConstantConditions(t *testing.T) {
+	tests := map[string]struct {
+		condition Condition
+		where     string
+	}{
+		"empty and":     {And(), "1 = 1"},
+		"empty or":      {Or(nil, nil), "1 = 0"},
+		"empty in":      {In("user_id"), "1 = 0"},
+		"not empty in":  {Not(In("user_id")), "NOT (1 = 0)"},
+		"single member": {And(nil, IsNull("email")), "`email` IS NULL"},
+		"not nil":       {And(Not(nil), IsNull("email")), "`email` IS NULL"},
+		"comparisons":   {And(NotEq("a", 1), Gt("b", 2), Gte("c", 3), Lt("d", 4), Lte("e", 5)), "(`a` <> ? AND `b` > ? AND `c` >= ? AND `d` < ? AND `e` <= ?)"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sql, _, err := Select("user_id").From("user").Where(test.condition).Build(MySQL)
+
+			assert.NoError(t, err)
+			assert.Equal(t, "SELECT `user_id` FROM `user` WHERE "+test.where, sql)
+		})
+	}
+}
+
+func Test_SelectBuilder_NotNil_ExpectNoWhereClause(t *testing.T) {
+	sql, args, err := Select("user_id").From("user").Where(Not(nil)).Build(MySQL)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT `user_id` FROM `user`", sql)
+	assert.Empty(t, args)
+}
+
+func Test_SelectBuilder_Invalid_ExpectError(t *testing.T) {
+	tests := map[string]*SelectBuilder{
+		"no table":          Select("user_id"),
+		"no column":         Select().From("user"),
+		"offset only":       Select("user_id").From("user").Offset(10),
+		"injected column":   Select("user_id").From("user").Where(Eq("name = '' OR 1 = 1 --", "x")),
+		"injected table":    Select("user_id").From("user; DROP TABLE user"),
+		"quoted identifier": Select("user_id`").From("user"),
+		"invalid direction": Select("user_id").From("user").OrderBy("name", "ASC; DROP TABLE user"),
+	}
+	for name, query := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := query.Build(MySQL)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+// Test_SelectBuilder_HostileValues_ExpectOnlyPlaceholders checks that no value ever reaches the SQL:
+// every value is an argument, bound to its own placeholder.
+func Test_SelectBuilder_HostileValues_ExpectOnlyPlaceholders(t *testing.T) {
+	hostile := []string{"' OR '1' = '1", "\"; DROP TABLE user; --", "`password` = `password`", "$1", "?", "%_\\", "\x00"}
+	for _, value := range hostile {
+		query := Select("user_id").From("user").Where(Or(
+			Eq("name", value), NotEq("name", value), Like("name", value), In("name", value, value),
+			Between("name", value, value), Not(Gt("name", value)),
+		))
+
+		for _, dialect := range []Dialect{MySQL, PostgreSQL, SQLite} {
+			sql, args, err := query.Build(dialect)
+
+			assert.NoError(t, err)
+			assert.Len(t, args, 8)
+			for _, arg := range args {
+				assert.Equal(t, value, arg)
+			}
+			withoutPlaceholders := sql
+			if dialect == PostgreSQL {
+				for position := len(args); position > 0; position-- {
+					withoutPlaceholders = strings.ReplaceAll(withoutPlaceholders, "$"+strconv.Itoa(position), "")
+				}
+				assert.Contains(t, sql, "$8")
+			} else {
+				assert.Equal(t, len(args), strings.Count(sql, "?"))
+			}
+			if value != "?" && value != "$1" {
+				assert.NotContains(t, withoutPlaceholders, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package database
+
+import (
+	"backend-sample/common"
+	"backend-sample/tracing"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultReencryptionBatchSize = 500
+	DefaultReencryptionPause     = 100 * time.Millisecond
+
+	// maxReportedFailures caps the failures kept in a report, the count keeps growing.
+	maxReportedFailures = 100
+)
+
+var (
+	selectReencryptionCheckpointQuery string = `SELECT key_id, last_user_id, reencrypted, failed, completed FROM reencryption_checkpoint WHERE job = ?`
+	upsertReencryptionCheckpointQuery string = `INSERT INTO reencryption_checkpoint (job, key_id, last_user_id, reencrypted, failed, completed) VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE key_id = VALUES(key_id), last_user_id = VALUES(last_user_id), reencrypted = VALUES(reencrypted), failed = VALUES(failed), completed = VALUES(completed)`
+	selectUserEmailsBatchQuery string = `SELECT user_id, email FROM user WHERE user_id > ? ORDER BY user_id LIMIT ?`
+	updateUserEmailQuery       string = `UPDATE user SET email = ?, email_index = ? WHERE user_id = ? AND email = ?`
+)
+
+type ReencryptionOptions struct {
+	BatchSize int `json:"batch_size"`
+	// Pause between batches keeps the load on the database low. Negative values disable it.
+	Pause time.Duration `json:"pause"`
+	// Restart ignores the checkpoint and walks the whole table again.
+	Restart bool `json:"restart"`
+}
+
+type ReencryptionFailure struct {
+	UserId uuid.UUID `json:"user_id"`
+	Error  string    `json:"error"`
+}
+
+type ReencryptionReport struct {
+	KeyId       string                `json:"key_id"`
+	Running     bool                  `json:"running"`
+	Completed   bool                  `json:"completed"`
+	Scanned     int                   `json:"scanned"`
+	Reencrypted int                   `json:"reencrypted"`
+	Skipped     int                   `json:"skipped"`
+	Failed      int                   `json:"failed"`
+	Failures    []ReencryptionFailure `json:"failures,omitempty"`
+	StartedAt   time.Time             `json:"started_at"`
+	FinishedAt  *time.Time            `json:"finished_at,omitempty"`
+	Error       string                `json:"error,omitempty"`
+}
+
+type reencryptionCheckpoint struct {
+	keyId       string
+	lastUserId  []byte
+	reencrypted int64
+	failed      int64
+	completed   bool
+}
+
+// Reencryptor re-encrypts the encrypted user columns under the active key after a key rotation.
+// It walks the table by user_id in batches and saves a checkpoint after each of them, so it can
+// be stopped at any time and resumed later. Values written meanwhile by the repository already
+// use the active key and are skipped.
+type Reencryptor struct {
+	db        *MySqlDatabaseService
+	encryptor *FieldEncryptor
+
+	mu     sync.Mutex
+	report ReencryptionReport
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewReencryptor(db *MySqlDatabaseService, encryptor *FieldEncryptor) *Reencryptor {
+	return &Reencryptor{db: db, encryptor: encryptor}
+}
+
+// Start runs the job in the background until it completes, fails or Stop is called.
+func (r *Reencryptor) Start(ctx context.Context, options ReencryptionOptions) *common.BackendError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.report.Running {
+		return common.NewBackendError(409, "Reencrypt.1", "re-encryption is already running", nil)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	r.cancel, r.done = cancel, done
+	r.report = ReencryptionReport{Running: true, KeyId: r.encryptor.ActiveKey(), StartedAt: time.Now()}
+	go func() {
+		defer close(done)
+		defer cancel()
+		r.Run(ctx, options)
+	}()
+
+	return nil
+}
+
+// Stop cancels the running job, if any, and waits for it to save its checkpoint.
+func (r *Reencryptor) Stop() {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Status returns the report of the running or last job.
+func (r *Reencryptor) Status() ReencryptionReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := r.report
+	report.Failures = append([]ReencryptionFailure(nil), r.report.Failures...)
+	return report
+}
+
+// Run re-encrypts synchronously and returns the report once done.
+func (r *Reencryptor) Run(ctx context.Context, options ReencryptionOptions) (report ReencryptionReport, berr *common.BackendError) {
+	ctx, span := tracing.Start(ctx, "reencryption.Run")
+	defer func() { tracing.End(span, berr) }()
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultReencryptionBatchSize
+	}
+	if options.Pause == 0 {
+		options.Pause = DefaultReencryptionPause
+	}
+
+	report = ReencryptionReport{Running: true, KeyId: r.encryptor.ActiveKey(), StartedAt: time.Now()}
+	defer func() {
+		finishedAt := time.Now()
+		report.Running, report.FinishedAt = false, &finishedAt
+		if berr != nil {
+			report.Error = berr.Error()
+		}
+		r.setReport(report)
+		slog.InfoContext(ctx, "re-encryption finished", "key_id", report.KeyId, "completed", report.Completed,
+			"scanned", report.Scanned, "reencrypted", report.Reencrypted, "skipped", report.Skipped, "failed", report.Failed)
+	}()
+	r.setReport(report)
+
+	cn, berr := r.db.GetConnection()
+	if berr != nil {
+		return report, berr
+	}
+
+	checkpoint, berr := r.loadCheckpoint(ctx, cn)
+	if berr != nil {
+		return report, berr
+	}
+	if options.Restart || checkpoint.keyId != report.KeyId {
+		checkpoint = reencryptionCheckpoint{keyId: report.KeyId, lastUserId: make([]byte, 16)}
+	}
+	if checkpoint.completed {
+		report.Completed = true
+		return report, nil
+	}
+
+	slog.InfoContext(ctx, "re-encryption started", "key_id", report.KeyId, "batch_size", options.BatchSize)
+	for {
+		rows, berr := r.processBatch(ctx, cn, &checkpoint, options.BatchSize, &report)
+		if berr != nil {
+			return report, berr
+		}
+
+		checkpoint.completed = rows < options.BatchSize && ctx.Err() == nil
+		if berr := r.saveCheckpoint(ctx, cn, checkpoint); berr != nil {
+			return report, berr
+		}
+		r.setReport(report)
+
+		if checkpoint.completed {
+			report.Completed = true
+			return report, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return report, common.NewBackendError(500, "Reencrypt.2", "re-encryption stopped, it resumes from the checkpoint", ctx.Err())
+		case <-time.After(max(options.Pause, 0)):
+		}
+	}
+}
+
+func (r *Reencryptor) processBatch(ctx context.Context, cn *sql.DB, checkpoint *reencryptionCheckpoint, batchSize int, report *ReencryptionReport) (int, *common.BackendError) {
+	rows, err := cn.QueryContext(ctx, selectUserEmailsBatchQuery, checkpoint.lastUserId, batchSize)
+	if err != nil {
+		return 0, common.NewBackendError(500, "Reencrypt.3", "could not read users batch", err)
+	}
+
+	type userEmail struct {
+		id    []byte
+		email string
+	}
+	batch := make([]userEmail, 0, batchSize)
+	for rows.Next() {
+		var row userEmail
+		if err := rows.Scan(&row.id, &row.email); err != nil {
+			rows.Close()
+			return 0, common.NewBackendError(500, "Reencrypt.4", "error reading row.", err)
+		}
+		batch = append(batch, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, common.NewBackendError(500, "Reencrypt.3", "could not read users batch", err)
+	}
+
+	for _, row := range batch {
+		// Rows left once stopped are processed on resume, as the checkpoint stays before them.
+		if ctx.Err() != nil {
+			break
+		}
+
+		reencrypted, err := r.reencryptEmail(ctx, cn, row.id, row.email)
+		if err != nil && ctx.Err() != nil {
+			// Stopped during the update, the row is not settled and neither counted nor passed.
+			break
+		}
+		report.Scanned++
+		checkpoint.lastUserId = row.id
+		switch {
+		case err != nil:
+			report.Failed++
+			checkpoint.failed++
+			id, _ := uuid.FromBytes(row.id)
+			if len(report.Failures) < maxReportedFailures {
+				report.Failures = append(report.Failures, ReencryptionFailure{UserId: id, Error: err.Error()})
+			}
+			slog.WarnContext(ctx, "could not re-encrypt user email", "user_id", id, "error", err)
+		case reencrypted:
+			report.Reencrypted++
+			checkpoint.reencrypted++
+		default:
+			report.Skipped++
+		}
+	}
+
+	return len(batch), nil
+}
+
+// reencryptEmail encrypts email under the active key unless it already is. Emails stored in
+// clear, from before they were encrypted, are encrypted and get their blind index.
+func (r *Reencryptor) reencryptEmail(ctx context.Context, cn *sql.DB, binary []byte, stored string) (bool, error) {
+	id, err := uuid.FromBytes(binary)
+	if err != nil {
+		return false, err
+	}
+
+	email := stored
+	if common.IsKeyringCiphertext(stored) {
+		if common.KeyIdOf(stored) == r.encryptor.ActiveKey() {
+			return false, nil
+		}
+		email, err = r.encryptor.Decrypt(userEmailColumn, id, stored)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	encrypted, err := r.encryptor.Encrypt(userEmailColumn, id, email)
+	if err != nil {
+		return false, err
+	}
+	index, err := r.encryptor.BlindIndex(userEmailColumn, normalizeEmail(email))
+	if err != nil {
+		return false, err
+	}
+
+	// The stored value is compared so a concurrent update, already using the active key, is not overwritten.
+	result, err := cn.ExecContext(ctx, updateUserEmailQuery, encrypted, index, binary, stored)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (r *Reencryptor) loadCheckpoint(ctx context.Context, cn *sql.DB) (reencryptionCheckpoint, *common.BackendError) {
+	var checkpoint reencryptionCheckpoint
+	err := cn.QueryRowContext(ctx, selectReencryptionCheckpointQuery, userEmailColumn).
+		Scan(&checkpoint.keyId, &checkpoint.lastUserId, &checkpoint.reencrypted, &checkpoint.failed, &checkpoint.completed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return reencryptionCheckpoint{}, nil
+	}
+	if err != nil {
+		return checkpoint, common.NewBackendError(500, "Reencrypt.5", "could not read checkpoint", err)
+	}
+	return checkpoint, nil
+}
+
+func (r *Reencryptor) saveCheckpoint(ctx context.Context, cn *sql.DB, checkpoint reencryptionCheckpoint) *common.BackendError {
+	// The checkpoint is saved even when the job is being stopped, so no batch is processed twice.
+	_, err := cn.ExecContext(context.WithoutCancel(ctx), upsertReencryptionCheckpointQuery, userEmailColumn, checkpoint.keyId,
+		checkpoint.lastUserId, checkpoint.reencrypted, checkpoint.failed, checkpoint.completed)
+	if err != nil {
+		return common.NewBackendError(500, "Reencrypt.6", "could not save checkpoint", err)
+	}
+	return nil
+}
+
+func (r *Reencryptor) setReport(report ReencryptionReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report.Failures = append([]ReencryptionFailure(nil), report.Failures...)
+	r.report = report
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"backend-sample/common"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func newRotatedEncryptors(t *testing.T) (previous, current *FieldEncryptor) {
+	t.Helper()
+	rotated := FieldEncryptionConfiguration{
+		ActiveKey: "v0",
+		Keys: []common.KeyConfiguration{
+			{Id: "v0", Value: "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="},
+			testFieldEncryption.Keys[0],
+		},
+		IndexKey: testFieldEncryption.IndexKey,
+	}
+	previous, err := NewFieldEncryptor(rotated)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	rotated.ActiveKey = "v1"
+	current, err = NewFieldEncryptor(rotated)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return previous, current
+}
+
+func Test_Reencryptor_Run_ReencryptsStaleRows(t *testing.T) {
+	previous, current := newRotatedEncryptors(t)
+	stale, active, plain, corrupted := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	staleEmail, _ := previous.Encrypt(userEmailColumn, stale, "stale@example.com")
+	activeEmail, _ := current.Encrypt(userEmailColumn, active, "active@example.com")
+	corruptedEmail, _ := previous.Encrypt(userEmailColumn, uuid.New(), "corrupted@example.com")
+	plainIndex, _ := current.BlindIndex(userEmailColumn, "plain@example.com")
+
+	sqlCnMock.ExpectQuery(regexp.QuoteMeta(selectReencryptionCheckpointQuery)).
+		WithArgs(userEmailColumn).
+		WillReturnRows(sqlmock.NewRows([]string{"key_id", "last_user_id", "reencrypted", "failed", "completed"}))
+	sqlCnMock.ExpectQuery(regexp.QuoteMeta(selectUserEmailsBatchQuery)).
+		WithArgs(make([]byte, 16), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).
+			AddRow(stale[:], staleEmail).
+			AddRow(active[:], activeEmail).
+			AddRow(plain[:], "Plain@example.com").
+			AddRow(corrupted[:], corruptedEmail))
+	sqlCnMock.ExpectExec(regexp.QuoteMeta(updateUserEmailQuery)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), stale[:], staleEmail).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlCnMock.ExpectExec(regexp.QuoteMeta(updateUserEmailQuery)).
+		WithArgs(sqlmock.AnyArg(), plainIndex, plain[:], "Plain@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlCnMock.ExpectExec(regexp.QuoteMeta("INSERT INTO reencryption_checkpoint")).
+		WithArgs(userEmailColumn, "v1", corrupted[:], 2, 1, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	report, berr := NewReencryptor(repo.db, current).Run(context.Background(), ReencryptionOptions{BatchSize: 10})
+	if berr != nil {
+		t.Fatalf("unexpected error: %s", berr)
+	}
+
+	if !report.Completed || report.Scanned != 4 || report.Reencrypted != 2 || report.Skipped != 1 || report.Failed != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].UserId != corrupted {
+		t.Errorf("expected the corrupted row to be reported, got %+v", report.Failures)
+	}
+	if err := sqlCnMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+func Test_Reencryptor_Run_ResumesFromCheckpoint(t *testing.T) {
+	_, current := newRotatedEncryptors(t)
+	last := uuid.New()
+
+	sqlCnMock.ExpectQuery(regexp.QuoteMeta(selectReencryptionCheckpointQuery)).
+		WithArgs(userEmailColumn).
+		WillReturnRows(sqlmock.NewRows([]string{"key_id", "last_user_id", "reencrypted", "failed", "completed"}).
+			AddRow("v1", last[:], 7, 0, false))
+	sqlCnMock.ExpectQuery(regexp.QuoteMeta(selectUserEmailsBatchQuery)).
+		WithArgs(last[:], 10).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}))
+	sqlCnMock.ExpectExec(regexp.QuoteMeta("INSERT INTO reencryption_checkpoint")).
+		WithArgs(userEmailColumn, "v1", last[:], 7, 0, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	report, berr := NewReencryptor(repo.db, current).Run(context.Background(), ReencryptionOptions{BatchSize: 10})
+	if berr != nil {
+		t.Fatalf("unexpected error: %s", berr)
+	}
+
+	if !report.Completed || report.Scanned != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if err := sqlCnMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+func Test_Reencryptor_Run_CheckpointOfPreviousKey_Restarts(t *testing.T) {
+	_, current := newRotatedEncryptors(t)
+	last := uuid.New()
+
+	sqlCnMock.ExpectQuery(regexp.QuoteMeta(selectReencryptionCheckpointQuery)).
+		WithArgs(userEmailColumn).
+		WillReturnRows(sqlmock.NewRows([]string{"key_id", "last_user_id", "reencrypted", "failed", "completed"}).
+			AddRow("v0", last[:], 7, 0, true))
+	sqlCnMock.ExpectQuery(regexp.QuoteMeta(selectUserEmailsBatchQuery)).
+		WithArgs(make([]byte, 16), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}))
+	sqlCnMock.ExpectExec(regexp.QuoteMeta("INSERT INTO reencryption_checkpoint")).
+		WithArgs(userEmailColumn, "v1", make([]byte, 16), 0, 0, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	reencryptor := NewReencryptor(repo.db, current)
+	if _, berr := reencryptor.Run(context.Background(), ReencryptionOptions{BatchSize: 10}); berr != nil {
+		t.Fatalf("unexpected error: %s", berr)
+	}
+
+	if status := reencryptor.Status(); status.Running || !status.Completed || status.FinishedAt == nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if err := sqlCnMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+func Test_Reencryptor_Run_StoppedDuringUpdate_ExpectRowLeftForResume(t *testing.T) {
+	previous, current := newRotatedEncryptors(t)
+	first, second := uuid.New(), uuid.New()
+	firstEmail, _ := previous.Encrypt(userEmailColumn, first, "first@example.com")
+	secondEmail, _ := previous.Encrypt(userEmailColumn, second, "second@example.com")
+
+	sqlCnMock.ExpectQuery(regexp.QuoteMeta(selectReencryptionCheckpointQuery)).
+		WithArgs(userEmailColumn).
+		WillReturnRows(sqlmock.NewRows([]string{"key_id", "last_user_id", "reencrypted", "failed", "completed"}))
+	sqlCnMock.ExpectQuery(regexp.QuoteMeta(selectUserEmailsBatchQuery)).
+		WithArgs(make([]byte, 16), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).
+			AddRow(first[:], firstEmail).
+			AddRow(second[:], secondEmail))
+	sqlCnMock.ExpectExec(regexp.QuoteMeta(updateUserEmailQuery)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), first[:], firstEmail).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The update of the second row hangs until the job is stopped.
+	sqlCnMock.ExpectExec(regexp.QuoteMeta(updateUserEmailQuery)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), second[:], secondEmail).
+		WillDelayFor(time.Minute).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlCnMock.ExpectExec(regexp.QuoteMeta("INSERT INTO reencryption_checkpoint")).
+		WithArgs(userEmailColumn, "v1", first[:], 1, 0, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer time.AfterFunc(100*time.Millisecond, cancel).Stop()
+	report, berr := NewReencryptor(repo.db, current).Run(ctx, ReencryptionOptions{BatchSize: 10})
+	if berr == nil || berr.Identifier != "Reencrypt.2" {
+		t.Fatalf("expected the job to be stopped, got %v", berr)
+	}
+
+	if report.Completed || report.Scanned != 1 || report.Reencrypted != 1 || report.Failed != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if err := sqlCnMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
@@ -0,0 +1,248 @@
+package database
+
+import (
+	"backend-sample/common"
+	"backend-sample/metrics"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SelectionRoundRobin   = "round-robin"
+	SelectionLeastLatency = "least-latency"
+
+	DefaultStickyWindow   = 5 * time.Second
+	DefaultHealthInterval = 5 * time.Second
+)
+
+type ReplicaConfiguration struct {
+	Host string `json:"host" yaml:"host"`
+	Port int    `json:"port" yaml:"port"`
+}
+
+// ReplicationConfiguration lists the read replicas of the primary. They share its database and credentials.
+type ReplicationConfiguration struct {
+	Replicas []ReplicaConfiguration `json:"replicas" yaml:"replicas"`
+	// Selection picks the replica of each read, round-robin by default or least-latency.
+	Selection string `json:"selection" yaml:"selection"`
+	// StickyWindow is how long the reads of a caller go to the primary after it writes, so it reads
+	// its own writes despite the replication lag.
+	StickyWindow time.Duration `json:"stickyWindow" yaml:"stickyWindow"`
+	// HealthInterval is the period of the pings deciding which replicas receive reads.
+	HealthInterval time.Duration `json:"healthInterval" yaml:"healthInterval"`
+}
+
+func (c ReplicationConfiguration) withDefaults() ReplicationConfiguration {
+	if c.Selection == "" {
+		c.Selection = SelectionRoundRobin
+	}
+	if c.StickyWindow == 0 {
+		c.StickyWindow = DefaultStickyWindow
+	}
+	if c.HealthInterval == 0 {
+		c.HealthInterval = DefaultHealthInterval
+	}
+	return c
+}
+
+// ValidateSelection checks the replica selection strategy, empty meaning round-robin.
+func ValidateSelection(selection string) error {
+	switch strings.ToLower(selection) {
+	case "", SelectionRoundRobin, SelectionLeastLatency:
+		return nil
+	}
+	return fmt.Errorf("unknown replica selection %q, expected %s or %s", selection, SelectionRoundRobin, SelectionLeastLatency)
+}
+
+type replica struct {
+	name    string
+	db      *sql.DB
+	breaker circuitBreaker
+	healthy atomic.Bool
+	// latency is the moving average of the ping latency, in nanoseconds.
+	latency atomic.Int64
+}
+
+// observe records the outcome of a health check.
+func (r *replica) observe(latency time.Duration, err error) {
+	healthy := err == nil
+	if r.healthy.Swap(healthy) != healthy {
+		slog.Warn("database replica health changed", "replica", r.name, "healthy", healthy, "error", err)
+	}
+	if healthy {
+		previous := time.Duration(r.latency.Load())
+		if previous > 0 {
+			latency = (previous*4 + latency) / 5
+		}
+		r.latency.Store(int64(latency))
+	}
+
+	metrics.DatabaseReplicaHealthy.WithLabelValues(r.name).Set(boolToFloat(healthy))
+	metrics.DatabaseReplicaLatency.WithLabelValues(r.name).Set(time.Duration(r.latency.Load()).Seconds())
+}
+
+type callerKey struct{}
+type primaryKey struct{}
+
+// WithCaller tags ctx with the caller making the request, whose reads go to the primary for a
+// short window after it writes.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// writeTracker remembers the last write of each caller for the sticky window.
+type writeTracker struct {
+	mu        sync.Mutex
+	writes    map[string]time.Time
+	lastSweep time.Time
+}
+
+func (t *writeTracker) record(caller string, now time.Time, window time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.writes == nil {
+		t.writes = make(map[string]time.Time)
+	}
+	t.writes[caller] = now
+
+	// Forget callers whose window is over, at most once per window.
+	if now.Sub(t.lastSweep) > window {
+		for caller, at := range t.writes {
+			if now.Sub(at) > window {
+				delete(t.writes, caller)
+			}
+		}
+		t.lastSweep = now
+	}
+}
+
+func (t *writeTracker) wroteWithin(caller string, now time.Time, window time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	at, ok := t.writes[caller]
+	return ok && now.Sub(at) <= window
+}
+
+// MarkWrite records that the caller of ctx has just written, and returns a context whose reads go
+// to the primary.
+func (m *MySqlDatabaseService) MarkWrite(ctx context.Context) context.Context {
+	if caller, _ := ctx.Value(callerKey{}).(string); caller != "" {
+		m.writes.record(caller, time.Now(), m.replicationPolicy().StickyWindow)
+	}
+	return readFromPrimary(ctx)
+}
+
+// readFromPrimary returns a context whose reads go to the primary.
+func readFromPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// GetReadConnection returns the pool of a healthy replica for the reads of ctx, or the primary one
+// when no replica is configured or healthy, or the caller has just written.
+func (m *MySqlDatabaseService) GetReadConnection(ctx context.Context) (*sql.DB, *common.BackendError) {
+	policy := m.replicationPolicy()
+	if len(m.replicas) == 0 || m.readsPrimary(ctx, policy) {
+		return m.GetConnection()
+	}
+
+	if selected := m.selectReplica(m.replicas, policy.Selection, m.CircuitBreakerPolicy()); selected != nil {
+		return selected.db, nil
+	}
+
+	slog.WarnContext(ctx, "no healthy database replica, reading from the primary")
+	return m.GetConnection()
+}
+
+func (m *MySqlDatabaseService) readsPrimary(ctx context.Context, policy ReplicationConfiguration) bool {
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary {
+		return true
+	}
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller != "" && m.writes.wroteWithin(caller, time.Now(), policy.StickyWindow)
+}
+
+// selectReplica picks a healthy replica whose circuit lets queries through.
+func (m *MySqlDatabaseService) selectReplica(replicas []*replica, selection string, circuit CircuitBreakerConfiguration) *replica {
+	now := time.Now()
+	healthy := make([]*replica, 0, len(replicas))
+	for _, r := range replicas {
+		if r.healthy.Load() && !r.breaker.rejecting(circuit, now) {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if strings.ToLower(selection) == SelectionLeastLatency {
+		fastest := healthy[0]
+		for _, r := range healthy[1:] {
+			if r.latency.Load() < fastest.latency.Load() {
+				fastest = r
+			}
+		}
+		return fastest
+	}
+	return healthy[(m.nextReplica.Add(1)-1)%uint64(len(healthy))]
+}
+
+// MonitorReplicas pings the replicas every health interval until ctx is done, taking the failing
+// ones out of the reads until they answer again.
+func (m *MySqlDatabaseService) MonitorReplicas(ctx context.Context) {
+	if len(m.replicas) == 0 {
+		return
+	}
+
+	for {
+		interval := m.replicationPolicy().HealthInterval
+		checkReplicas(ctx, m.replicas, interval)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func checkReplicas(ctx context.Context, replicas []*replica, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := r.db.PingContext(pingCtx)
+			r.observe(time.Since(start), err)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *MySqlDatabaseService) replicationPolicy() ReplicationConfiguration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.Configuration.Replication.withDefaults()
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
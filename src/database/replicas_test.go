@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReplicatedService(t *testing.T, selection string, replicaCount int) (*MySqlDatabaseService, []*replica) {
+	t.Helper()
+	primary, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { primary.Close() })
+
+	config := dbConfig
+	config.Replication = ReplicationConfiguration{Selection: selection, StickyWindow: time.Minute}
+	service := &MySqlDatabaseService{Configuration: config, db: primary}
+	for i := 0; i < replicaCount; i++ {
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		config.Replication.Replicas = append(config.Replication.Replicas, ReplicaConfiguration{Host: "replica", Port: 3306 + i})
+		r := &replica{name: "replica", db: db}
+		r.healthy.Store(true)
+		service.replicas = append(service.replicas, r)
+	}
+	service.Configuration = config
+	return service, service.replicas
+}
+
+func readConnection(t *testing.T, service *MySqlDatabaseService, ctx context.Context) *sql.DB {
+	t.Helper()
+	cn, berr := service.GetReadConnection(ctx)
+	if berr != nil {
+		t.Fatalf("unexpected error: %s", berr)
+	}
+	return cn
+}
+
+func Test_GetReadConnection_RoundRobin_ExpectEveryHealthyReplica(t *testing.T) {
+	service, replicas := newReplicatedService(t, SelectionRoundRobin, 3)
+	replicas[1].observe(time.Millisecond, errors.New("unreachable"))
+
+	ctx := context.Background()
+	assert.Same(t, replicas[0].db, readConnection(t, service, ctx))
+	assert.Same(t, replicas[2].db, readConnection(t, service, ctx))
+	assert.Same(t, replicas[0].db, readConnection(t, service, ctx))
+}
+
+func Test_GetReadConnection_LeastLatency_ExpectFastestReplica(t *testing.T) {
+	service, replicas := newReplicatedService(t, SelectionLeastLatency, 2)
+	replicas[0].observe(20*time.Millisecond, nil)
+	replicas[1].observe(5*time.Millisecond, nil)
+
+	assert.Same(t, replicas[1].db, readConnection(t, service, context.Background()))
+}
+
+func Test_GetReadConnection_NoHealthyReplica_ExpectPrimary(t *testing.T) {
+	service, replicas := newReplicatedService(t, SelectionRoundRobin, 1)
+	replicas[0].observe(time.Millisecond, errors.New("unreachable"))
+
+	assert.Same(t, service.db, readConnection(t, service, context.Background()))
+}
+
+func Test_GetReadConnection_AfterWrite_ExpectPrimaryForCaller(t *testing.T) {
+	service, replicas := newReplicatedService(t, SelectionRoundRobin, 1)
+	writer := WithCaller(context.Background(), "client-1")
+
+	assert.Same(t, service.db, readConnection(t, service, service.MarkWrite(writer)))
+	assert.Same(t, service.db, readConnection(t, service, writer))
+	assert.Same(t, replicas[0].db, readConnection(t, service, WithCaller(context.Background(), "client-2")))
+}
+
+func Test_WriteTracker_ExpiredWindow_ExpectForgotten(t *testing.T) {
+	var tracker writeTracker
+	now := time.Now()
+	tracker.record("client-1", now, time.Second)
+
+	assert.True(t, tracker.wroteWithin("client-1", now.Add(time.Second), time.Second))
+	assert.False(t, tracker.wroteWithin("client-1", now.Add(2*time.Second), time.Second))
+
+	tracker.record("client-2", now.Add(3*time.Second), time.Second)
+	assert.NotContains(t, tracker.writes, "client-1")
+}
+
+func Test_Execute_ReplicaCircuitOpen_ExpectPrimaryServed(t *testing.T) {
+	service, replicas := newReplicatedService(t, SelectionRoundRobin, 2)
+	service.SetCircuitBreakerPolicy(CircuitBreakerConfiguration{FailureThreshold: 1, OpenTimeout: time.Minute})
+	failing := func() error { return driver.ErrBadConn }
+	succeeding := func() error { return nil }
+
+	assert.ErrorIs(t, service.Execute(context.Background(), replicas[0].db, "test", false, failing), driver.ErrBadConn)
+
+	var circuitErr *CircuitOpenError
+	assert.ErrorAs(t, service.Execute(context.Background(), replicas[0].db, "test", false, succeeding), &circuitErr)
+	assert.NoError(t, service.Execute(context.Background(), service.db, "test", false, succeeding))
+	assert.NoError(t, service.Execute(context.Background(), replicas[1].db, "test", false, succeeding))
+
+	ctx := context.Background()
+	assert.Same(t, replicas[1].db, readConnection(t, service, ctx), "the replica whose circuit is open gets no reads")
+	assert.Same(t, replicas[1].db, readConnection(t, service, ctx))
+}
+
+func Test_Execute_PrimaryCircuitOpen_ExpectReplicasServed(t *testing.T) {
+	service, replicas := newReplicatedService(t, SelectionRoundRobin, 1)
+	service.SetCircuitBreakerPolicy(CircuitBreakerConfiguration{FailureThreshold: 1, OpenTimeout: time.Minute})
+
+	_ = service.Execute(context.Background(), service.db, "test", false, func() error { return driver.ErrBadConn })
+
+	var circuitErr *CircuitOpenError
+	assert.ErrorAs(t, service.Execute(context.Background(), service.db, "test", false, func() error { return nil }), &circuitErr)
+	assert.NoError(t, service.Execute(context.Background(), replicas[0].db, "test", false, func() error { return nil }))
+}
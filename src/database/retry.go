@@ -0,0 +1,133 @@
+package database
+
+import (
+	"backend-sample/metrics"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	DefaultRetryMaxAttempts    = 3
+	DefaultRetryInitialBackoff = 50 * time.Millisecond
+	DefaultRetryMaxBackoff     = time.Second
+)
+
+type RetryConfiguration struct {
+	// MaxAttempts counts the first attempt, 1 disables retries. Zero uses DefaultRetryMaxAttempts.
+	MaxAttempts    int           `json:"maxAttempts" yaml:"maxAttempts"`
+	InitialBackoff time.Duration `json:"initialBackoff" yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `json:"maxBackoff" yaml:"maxBackoff"`
+}
+
+// withDefaults fills the settings left empty.
+func (c RetryConfiguration) withDefaults() RetryConfiguration {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = DefaultRetryInitialBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	return c
+}
+
+// backoff returns the pause before retry number attempt, starting at 1: exponential up to
+// MaxBackoff with full jitter, so clients failing together do not retry together.
+func (c RetryConfiguration) backoff(attempt int) time.Duration {
+	ceiling := c.InitialBackoff << (attempt - 1)
+	if ceiling <= 0 || ceiling > c.MaxBackoff {
+		ceiling = c.MaxBackoff
+	}
+	return rand.N(ceiling) + 1
+}
+
+// Execute runs query on the pool cn behind its circuit breaker, retrying it until it succeeds, fails
+// with an error not worth retrying or runs out of attempts. Deadlocks and lock timeouts roll the
+// statement back, so they are always retried. A lost connection may have happened after the statement
+// was applied, so it is only retried when idempotent is true.
+func (m *MySqlDatabaseService) Execute(ctx context.Context, cn *sql.DB, operation string, idempotent bool, query func() error) error {
+	policy, circuit, breaker := m.RetryPolicy(), m.CircuitBreakerPolicy(), m.breakerOf(cn)
+
+	for attempt := 1; ; attempt++ {
+		if err := breaker.allow(circuit, time.Now()); err != nil {
+			return err
+		}
+		err := query()
+		if err != nil && ctx.Err() != nil {
+			// Drivers report an interrupted query in their own words, keep why it was interrupted.
+			err = errors.Join(ctx.Err(), err)
+		}
+		breaker.record(circuit, err, time.Now())
+		if err == nil {
+			if attempt > 1 {
+				metrics.RepositoryRetries.WithLabelValues(operation, "recovered").Inc()
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if !isRetryable(err, idempotent) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			metrics.RepositoryRetries.WithLabelValues(operation, "exhausted").Inc()
+			slog.WarnContext(ctx, "database operation failed after retries", "operation", operation, "attempts", attempt, "error", err)
+			return err
+		}
+
+		backoff := policy.backoff(attempt)
+		metrics.RepositoryRetries.WithLabelValues(operation, "retried").Inc()
+		slog.WarnContext(ctx, "retrying database operation", "operation", operation, "attempt", attempt, "backoff", backoff, "error", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// RetryPolicy returns the retry settings, defaults filled in.
+func (m *MySqlDatabaseService) RetryPolicy() RetryConfiguration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.Configuration.Retry.withDefaults()
+}
+
+// SetRetryPolicy changes the retry settings of the next database operations.
+func (m *MySqlDatabaseService) SetRetryPolicy(retry RetryConfiguration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Configuration.Retry = retry
+}
+
+func isRetryable(err error, idempotent bool) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case erLockDeadlock, erLockWaitTimeout:
+			return true
+		case erConCount:
+			// The server refused the connection before running anything.
+			return true
+		case erServerShutdown:
+			return idempotent
+		}
+		return false
+	}
+
+	return idempotent && isConnectionError(err)
+}
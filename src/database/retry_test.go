@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var deadlock = &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+func newRetryService(maxAttempts int) *MySqlDatabaseService {
+	return &MySqlDatabaseService{Configuration: DatabaseConfiguration{
+		Retry: RetryConfiguration{MaxAttempts: maxAttempts, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+	}}
+}
+
+func Test_Execute_Deadlock_ExpectRetriedUntilSuccess(t *testing.T) {
+	attempts := 0
+	err := newRetryService(3).Execute(context.Background(), nil, "test", false, func() error {
+		attempts++
+		if attempts < 3 {
+			return deadlock
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func Test_Execute_ExhaustedAttempts_ExpectLastError(t *testing.T) {
+	attempts := 0
+	err := newRetryService(2).Execute(context.Background(), nil, "test", true, func() error {
+		attempts++
+		return driver.ErrBadConn
+	})
+
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Equal(t, 2, attempts)
+}
+
+func Test_Execute_LostConnectionNotIdempotent_ExpectNoRetry(t *testing.T) {
+	attempts := 0
+	err := newRetryService(3).Execute(context.Background(), nil, "test", false, func() error {
+		attempts++
+		return mysql.ErrInvalidConn
+	})
+
+	assert.ErrorIs(t, err, mysql.ErrInvalidConn)
+	assert.Equal(t, 1, attempts)
+}
+
+func Test_Execute_PermanentError_ExpectNoRetry(t *testing.T) {
+	attempts := 0
+	duplicate := &mysql.MySQLError{Number: 1062}
+	err := newRetryService(3).Execute(context.Background(), nil, "test", true, func() error {
+		attempts++
+		return duplicate
+	})
+
+	assert.Equal(t, duplicate, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func Test_Execute_CanceledContext_ExpectStopWaiting(t *testing.T) {
+	service := &MySqlDatabaseService{Configuration: DatabaseConfiguration{
+		Retry: RetryConfiguration{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts := 0
+	err := service.Execute(ctx, nil, "test", true, func() error {
+		attempts++
+		return deadlock
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, deadlock)
+	assert.Equal(t, 1, attempts)
+}
+
+func Test_RetryConfiguration_Backoff_ExpectCappedWithJitter(t *testing.T) {
+	policy := RetryConfiguration{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+
+	for attempt := 1; attempt < 70; attempt++ {
+		backoff := policy.backoff(attempt)
+		assert.Greater(t, backoff, time.Duration(0))
+		assert.LessOrEqual(t, backoff, 50*time.Millisecond)
+	}
+}
+
+func Test_GetUserById_Deadlock_ExpectRetried(t *testing.T) {
+	resetStatements(t)
+	query := regexp.QuoteMeta("SELECT user_id, name, email, password FROM user WHERE user_id = ?")
+	sqlCnMock.ExpectPrepare(query).ExpectQuery().WillReturnError(deadlock)
+	// The retry reuses the prepared statement.
+	sqlCnMock.ExpectQuery(query).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "password"}).
+			AddRow(newUserRowArgs(t, "john@example.com")...))
+
+	user, err := repo.GetUserById(context.Background(), uuid.New())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assert.Equal(t, "john@example.com", user.Email)
+	assert.NoError(t, sqlCnMock.ExpectationsWereMet())
+}
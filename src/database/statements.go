@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// maxStatements bounds the statements prepared per pool, queries beyond it are sent unprepared.
+const maxStatements = 128
+
+// statementCache prepares each query once per pool. The statements are safe for concurrent use
+// and database/sql prepares them again on the connections that do not have them yet.
+type statementCache struct {
+	mu         sync.Mutex
+	statements map[*sql.DB]map[string]*sql.Stmt
+}
+
+// prepare returns the statement of query on db, or nil when the cache is full.
+func (c *statementCache) prepare(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	statement, ok := c.statements[db][query]
+	full := len(c.statements[db]) >= maxStatements
+	c.mu.Unlock()
+	if ok || full {
+		return statement, nil
+	}
+
+	// Prepared without the lock, a round trip must not hold back the queries already prepared.
+	statement, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.statements == nil {
+		c.statements = make(map[*sql.DB]map[string]*sql.Stmt)
+	}
+	if c.statements[db] == nil {
+		c.statements[db] = make(map[string]*sql.Stmt)
+	}
+	if existing, ok := c.statements[db][query]; ok {
+		// Another query prepared it meanwhile.
+		statement.Close()
+		return existing, nil
+	}
+	c.statements[db][query] = statement
+	return statement, nil
+}
+
+// close closes every statement, before the pools are closed.
+func (c *statementCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for _, statements := range c.statements {
+		for _, statement := range statements {
+			errs = append(errs, statement.Close())
+		}
+	}
+	c.statements = nil
+	return errors.Join(errs...)
+}
+
+// queryContext runs query on db with a prepared statement.
+func (m *MySqlDatabaseService) queryContext(ctx context.Context, db *sql.DB, query string, args ...any) (*sql.Rows, error) {
+	statement, err := m.statements.prepare(ctx, db, query)
+	if err != nil {
+		return nil, err
+	}
+	if statement == nil {
+		return db.QueryContext(ctx, query, args...)
+	}
+	return statement.QueryContext(ctx, args...)
+}
+
+// execContext runs query on db with a prepared statement.
+func (m *MySqlDatabaseService) execContext(ctx context.Context, db *sql.DB, query string, args ...any) (sql.Result, error) {
+	statement, err := m.statements.prepare(ctx, db, query)
+	if err != nil {
+		return nil, err
+	}
+	if statement == nil {
+		return db.ExecContext(ctx, query, args...)
+	}
+	return statement.ExecContext(ctx, args...)
+}
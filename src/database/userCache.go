@@ -0,0 +1,228 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	CacheBackendNone   = "none"
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+
+	DefaultCacheTTL         = time.Minute
+	DefaultCacheNegativeTTL = 5 * time.Second
+	DefaultCacheSize        = 10000
+)
+
+type RedisConfiguration struct {
+	Address  string `json:"address" yaml:"address"`
+	Password string `json:"password" yaml:"password"`
+	DB       int    `json:"db" yaml:"db"`
+}
+
+type CacheConfiguration struct {
+	// Backend is none by default, memory for a cache per process or redis for one shared by every instance.
+	Backend string `json:"backend" yaml:"backend"`
+	// TTL bounds how long a user may be served stale after a write made through another instance.
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+	// NegativeTTL is how long an unknown id is remembered as not found.
+	NegativeTTL time.Duration `json:"negativeTtl" yaml:"negativeTtl"`
+	// Size is the number of users kept by the memory backend, the least recently used are evicted.
+	Size  int                `json:"size" yaml:"size"`
+	Redis RedisConfiguration `json:"redis" yaml:"redis"`
+}
+
+func (c CacheConfiguration) withDefaults() CacheConfiguration {
+	if c.TTL == 0 {
+		c.TTL = DefaultCacheTTL
+	}
+	if c.NegativeTTL == 0 {
+		c.NegativeTTL = DefaultCacheNegativeTTL
+	}
+	if c.Size == 0 {
+		c.Size = DefaultCacheSize
+	}
+	return c
+}
+
+// ValidateCacheBackend checks the cache backend, empty meaning none.
+func ValidateCacheBackend(backend string) error {
+	switch strings.ToLower(backend) {
+	case "", CacheBackendNone, CacheBackendMemory, CacheBackendRedis:
+		return nil
+	}
+	return fmt.Errorf("unknown cache backend %q, expected %s, %s or %s", backend, CacheBackendNone, CacheBackendMemory, CacheBackendRedis)
+}
+
+// UserCache stores users by id. A nil user is a negative entry, remembering that the id does not exist.
+type UserCache interface {
+	// Get returns the cached user of id, found reporting whether an entry, positive or negative, exists.
+	Get(ctx context.Context, id uuid.UUID) (user *UserEntity, found bool, err error)
+	Set(ctx context.Context, id uuid.UUID, user *UserEntity, ttl time.Duration) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	Close() error
+}
+
+// NewUserCache creates the cache of config, or returns nil when caching is disabled. The redis
+// backend encrypts its entries with encryptor, as emails must not leave the database in plaintext.
+func NewUserCache(config CacheConfiguration, encryptor *FieldEncryptor) (UserCache, error) {
+	config = config.withDefaults()
+	switch strings.ToLower(config.Backend) {
+	case "", CacheBackendNone:
+		return nil, nil
+	case CacheBackendMemory:
+		return newLRUCache(config.Size), nil
+	case CacheBackendRedis:
+		client := redis.NewClient(&redis.Options{Addr: config.Redis.Address, Password: config.Redis.Password, DB: config.Redis.DB})
+		return &redisCache{client: client, encryptor: encryptor}, nil
+	}
+	return nil, ValidateCacheBackend(config.Backend)
+}
+
+type lruEntry struct {
+	id      uuid.UUID
+	user    *UserEntity
+	expires time.Time
+}
+
+// lruCache keeps the most recently used users of this process.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[uuid.UUID]*list.Element
+	now     func() time.Time
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{size: size, order: list.New(), entries: make(map[uuid.UUID]*list.Element), now: time.Now}
+}
+
+func (c *lruCache) Get(_ context.Context, id uuid.UUID) (*UserEntity, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[id]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, id)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(element)
+	return copyUser(entry.user), true, nil
+}
+
+func (c *lruCache) Set(_ context.Context, id uuid.UUID, user *UserEntity, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lruEntry{id: id, user: copyUser(user), expires: c.now().Add(ttl)}
+	if element, ok := c.entries[id]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[id] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).id)
+	}
+	return nil
+}
+
+func (c *lruCache) Delete(_ context.Context, id uuid.UUID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		c.order.Remove(element)
+		delete(c.entries, id)
+	}
+	return nil
+}
+
+func (c *lruCache) Close() error {
+	return nil
+}
+
+// userCacheColumn binds the encrypted entries of the redis cache to their id, as the email column does.
+const userCacheColumn = "cache.user"
+
+// redisEntry is the JSON of a cached user, User being nil for a negative entry.
+type redisEntry struct {
+	User *UserEntity `json:"user"`
+}
+
+// redisCache shares users between instances through Redis.
+type redisCache struct {
+	client    *redis.Client
+	encryptor *FieldEncryptor
+}
+
+func redisKey(id uuid.UUID) string {
+	return "users:" + id.String()
+}
+
+func (c *redisCache) Get(ctx context.Context, id uuid.UUID) (*UserEntity, bool, error) {
+	value, err := c.client.Get(ctx, redisKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	plaintext, err := c.encryptor.Decrypt(userCacheColumn, id, value)
+	if err != nil {
+		return nil, false, err
+	}
+	var entry redisEntry
+	if err := json.Unmarshal([]byte(plaintext), &entry); err != nil {
+		return nil, false, err
+	}
+	return entry.User, true, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, id uuid.UUID, user *UserEntity, ttl time.Duration) error {
+	plaintext, err := json.Marshal(redisEntry{User: user})
+	if err != nil {
+		return err
+	}
+	value, err := c.encryptor.Encrypt(userCacheColumn, id, string(plaintext))
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, redisKey(id), value, ttl).Err()
+}
+
+func (c *redisCache) Delete(ctx context.Context, id uuid.UUID) error {
+	return c.client.Del(ctx, redisKey(id)).Err()
+}
+
+func (c *redisCache) Close() error {
+	return c.client.Close()
+}
+
+func copyUser(user *UserEntity) *UserEntity {
+	if user == nil {
+		return nil
+	}
+	copied := *user
+	return &copied
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LRUCache_ExpectEvictionAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := newLRUCache(2)
+	cache.now = func() time.Time { return now }
+
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	cache.Set(ctx, first, &UserEntity{Id: first, Name: "first"}, time.Minute)
+	cache.Set(ctx, second, &UserEntity{Id: second, Name: "second"}, time.Second)
+	cache.Get(ctx, first)
+	cache.Set(ctx, third, nil, time.Minute)
+
+	_, found, _ := cache.Get(ctx, second)
+	assert.False(t, found, "least recently used entry should be evicted")
+	user, found, _ := cache.Get(ctx, third)
+	assert.True(t, found)
+	assert.Nil(t, user)
+
+	user, _, _ = cache.Get(ctx, first)
+	user.Name = "modified"
+	user, _, _ = cache.Get(ctx, first)
+	assert.Equal(t, "first", user.Name)
+
+	now = now.Add(2 * time.Minute)
+	_, found, _ = cache.Get(ctx, first)
+	assert.False(t, found, "expired entry should not be returned")
+}
+
+func Test_RedisCache_ExpectEncryptedEntries(t *testing.T) {
+	server := miniredis.RunT(t)
+	encryptor, err := NewFieldEncryptor(testFieldEncryption)
+	assert.NoError(t, err)
+	cache, err := NewUserCache(CacheConfiguration{Backend: CacheBackendRedis, Redis: RedisConfiguration{Address: server.Addr()}}, encryptor)
+	assert.NoError(t, err)
+	defer cache.Close()
+
+	ctx := context.Background()
+	id, missing := uuid.New(), uuid.New()
+	assert.NoError(t, cache.Set(ctx, id, &UserEntity{Id: id, Name: "John Doe", Email: "john@example.com"}, time.Minute))
+	assert.NoError(t, cache.Set(ctx, missing, nil, time.Second))
+
+	user, found, err := cache.Get(ctx, id)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "john@example.com", user.Email)
+
+	stored, err := server.Get("users:" + id.String())
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(stored, "john@example.com"), "email should not be stored in plaintext")
+
+	user, found, err = cache.Get(ctx, missing)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Nil(t, user)
+
+	server.FastForward(2 * time.Second)
+	_, found, _ = cache.Get(ctx, missing)
+	assert.False(t, found)
+
+	assert.NoError(t, cache.Delete(ctx, id))
+	_, found, _ = cache.Get(ctx, id)
+	assert.False(t, found)
+}
+
+func Test_NewUserCache_None_ExpectNil(t *testing.T) {
+	cache, err := NewUserCache(CacheConfiguration{}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, cache)
+
+	_, err = NewUserCache(CacheConfiguration{Backend: "memcached"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"backend-sample/common"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultLoaderWait is how long a UserLoader collects ids before querying them.
+const DefaultLoaderWait = time.Millisecond
+
+// UserLoader collects the ids looked up at about the same time, e.g. by the goroutines resolving
+// the users of a list, and reads them with one GetUsersByIds. It remembers the users it loaded, so
+// create one per request.
+type UserLoader struct {
+	repository UsersRepository
+	wait       time.Duration
+	mu         sync.Mutex
+	pending    *userBatch
+	batches    map[uuid.UUID]*userBatch
+}
+
+type userBatch struct {
+	ids   []uuid.UUID
+	once  sync.Once
+	done  chan struct{}
+	users map[uuid.UUID]*UserEntity
+	berr  *common.BackendError
+}
+
+func NewUserLoader(repository UsersRepository) *UserLoader {
+	return &UserLoader{repository: repository, wait: DefaultLoaderWait, batches: make(map[uuid.UUID]*userBatch)}
+}
+
+// Load returns the user of id once its batch is read, with the 404 of GetUserById when it does not exist.
+func (l *UserLoader) Load(ctx context.Context, id uuid.UUID) (*UserEntity, *common.BackendError) {
+	l.mu.Lock()
+	batch, ok := l.batches[id]
+	if !ok {
+		if l.pending == nil {
+			l.pending = &userBatch{done: make(chan struct{})}
+			pending := l.pending
+			time.AfterFunc(l.wait, func() { l.dispatch(ctx, pending) })
+		}
+		batch = l.pending
+		batch.ids = append(batch.ids, id)
+		l.batches[id] = batch
+		if len(batch.ids) >= maxBatchSize {
+			l.pending = nil
+			go l.dispatch(ctx, batch)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, classifyError(ctx.Err(), common.NewBackendError(500, "GetUserById.2", "error querying user by id %s.", ctx.Err(), id.String()))
+	case <-batch.done:
+	}
+	if batch.berr != nil {
+		return nil, batch.berr
+	}
+	user, ok := batch.users[id]
+	if !ok {
+		return nil, common.NewBackendError(404, "GetUserById.3", "user not found for id %s", nil, id.String())
+	}
+	return copyUser(user), nil
+}
+
+// dispatch reads batch, once, with the context of the load that started it.
+func (l *UserLoader) dispatch(ctx context.Context, batch *userBatch) {
+	l.mu.Lock()
+	if l.pending == batch {
+		l.pending = nil
+	}
+	l.mu.Unlock()
+
+	batch.once.Do(func() {
+		defer close(batch.done)
+
+		// Shared by every load of the batch, it must outlive the one that started it.
+		ctx, cancel := detach(ctx)
+		defer cancel()
+
+		users, berr := l.repository.GetUsersByIds(ctx, batch.ids)
+		if berr != nil {
+			batch.berr = berr
+			l.forget(batch)
+			return
+		}
+		batch.users = make(map[uuid.UUID]*UserEntity, len(*users))
+		for i := range *users {
+			batch.users[(*users)[i].Id] = &(*users)[i]
+		}
+	})
+}
+
+// forgetUser lets the next load of id query it again, once it was written.
+func (l *UserLoader) forgetUser(id uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.batches, id)
+}
+
+// forget lets the next loads of a failed batch query their ids again.
+func (l *UserLoader) forget(batch *userBatch) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, id := range batch.ids {
+		if l.batches[id] == batch {
+			delete(l.batches, id)
+		}
+	}
+}
+
+type userLoaderKey struct{}
+
+// userLoaders holds the loaders of one request, created on its first lookup by id.
+type userLoaders struct {
+	mu      sync.Mutex
+	loaders map[UsersRepository]*UserLoader
+}
+
+// WithUserLoader prepares ctx for a UserLoader, so the lookups by id of a request made through a
+// repository of NewBatchingRepository share queries.
+func WithUserLoader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, userLoaderKey{}, &userLoaders{loaders: make(map[UsersRepository]*UserLoader)})
+}
+
+// batchingRepository reads users by id through the UserLoader of the request, when it has one.
+// Its writes make the loader forget the user, so the request reads what it wrote.
+type batchingRepository struct {
+	UsersRepository
+}
+
+// NewBatchingRepository decorates repository to batch the lookups by id of each request prepared
+// by WithUserLoader. Lookups of other contexts go to repository alone.
+func NewBatchingRepository(repository UsersRepository) UsersRepository {
+	return &batchingRepository{UsersRepository: repository}
+}
+
+func (repo *batchingRepository) GetUserById(ctx context.Context, id uuid.UUID) (*UserEntity, *common.BackendError) {
+	if loader := repo.loaderOf(ctx, true); loader != nil {
+		return loader.Load(ctx, id)
+	}
+	return repo.UsersRepository.GetUserById(ctx, id)
+}
+
+func (repo *batchingRepository) UpdateUser(ctx context.Context, user UserEntity) *common.BackendError {
+	defer repo.forgetUser(ctx, user.Id)
+	return repo.UsersRepository.UpdateUser(ctx, user)
+}
+
+func (repo *batchingRepository) DeleteUser(ctx context.Context, id uuid.UUID) *common.BackendError {
+	defer repo.forgetUser(ctx, id)
+	return repo.UsersRepository.DeleteUser(ctx, id)
+}
+
+func (repo *batchingRepository) forgetUser(ctx context.Context, id uuid.UUID) {
+	if loader := repo.loaderOf(ctx, false); loader != nil {
+		loader.forgetUser(id)
+	}
+}
+
+// loaderOf returns the loader of the request of ctx, creating it when create is true, or nil when
+// the request has none.
+func (repo *batchingRepository) loaderOf(ctx context.Context, create bool) *UserLoader {
+	loaders, ok := ctx.Value(userLoaderKey{}).(*userLoaders)
+	if !ok {
+		return nil
+	}
+
+	loaders.mu.Lock()
+	defer loaders.mu.Unlock()
+
+	loader := loaders.loaders[repo.UsersRepository]
+	if loader == nil && create {
+		loader = NewUserLoader(repo.UsersRepository)
+		loaders.loaders[repo.UsersRepository] = loader
+	}
+	return loader
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_UserLoader_ConcurrentLoads_ExpectOneBatch(t *testing.T) {
+	john, jane := UserEntity{Id: uuid.New(), Name: "John Doe"}, UserEntity{Id: uuid.New(), Name: "Jane Doe"}
+	inner := &countingRepository{users: map[uuid.UUID]UserEntity{john.Id: john, jane.Id: jane}}
+	loader := NewUserLoader(inner)
+	unknown := uuid.New()
+
+	var wg sync.WaitGroup
+	for _, id := range []uuid.UUID{john.Id, jane.Id, john.Id, unknown} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, berr := loader.Load(context.Background(), id)
+			if id == unknown {
+				assert.Equal(t, 404, berr.Code)
+				return
+			}
+			assert.Nil(t, berr)
+			assert.Equal(t, id, user.Id)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), inner.batches.Load())
+
+	user, berr := loader.Load(context.Background(), jane.Id)
+	assert.Nil(t, berr)
+	assert.Equal(t, "Jane Doe", user.Name)
+	assert.Equal(t, int32(1), inner.batches.Load(), "loaded users should be remembered")
+}
+
+func Test_BatchingRepository_RequestLookups_ExpectOneBatch(t *testing.T) {
+	john, jane := UserEntity{Id: uuid.New(), Name: "John Doe"}, UserEntity{Id: uuid.New(), Name: "Jane Doe"}
+	inner := &countingRepository{users: map[uuid.UUID]UserEntity{john.Id: john, jane.Id: jane}}
+	repo := NewBatchingRepository(inner)
+	ctx := WithUserLoader(context.Background())
+
+	var wg sync.WaitGroup
+	for _, id := range []uuid.UUID{john.Id, jane.Id, john.Id} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, berr := repo.GetUserById(ctx, id)
+			assert.Nil(t, berr)
+			assert.Equal(t, id, user.Id)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), inner.batches.Load())
+	assert.Equal(t, int32(0), inner.lookups.Load())
+
+	// The request reads its own write instead of the user the loader remembers.
+	assert.Nil(t, repo.UpdateUser(ctx, UserEntity{Id: john.Id, Name: "Johnny Doe"}))
+	user, berr := repo.GetUserById(ctx, john.Id)
+	assert.Nil(t, berr)
+	assert.Equal(t, "Johnny Doe", user.Name)
+	assert.Equal(t, int32(2), inner.batches.Load())
+}
+
+func Test_BatchingRepository_NoLoader_ExpectLookupById(t *testing.T) {
+	john := UserEntity{Id: uuid.New(), Name: "John Doe"}
+	inner := &countingRepository{users: map[uuid.UUID]UserEntity{john.Id: john}}
+	repo := NewBatchingRepository(inner)
+
+	user, berr := repo.GetUserById(context.Background(), john.Id)
+
+	assert.Nil(t, berr)
+	assert.Equal(t, "John Doe", user.Name)
+	assert.Equal(t, int32(1), inner.lookups.Load())
+	assert.Equal(t, int32(0), inner.batches.Load())
+}
@@ -2,11 +2,16 @@ package database
 
 import (
 	"backend-sample/common"
-	"fmt"
-	"log"
+	"backend-sample/metrics"
+	"backend-sample/tracing"
+	"context"
+	"database/sql"
+	"iter"
+	"log/slog"
 	"strings"
 
 	"github.com/google/uuid"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 type UserEntity struct {
@@ -19,49 +24,71 @@ type UserWhereClause struct {
 	Name, Email string
 }
 
+// userEmailColumn names the encrypted email column in associated data and blind indexes.
+const userEmailColumn = "user.email"
+
 var (
-	insertUserQuery     string = `INSERT INTO user (user_id, name, email, password) VALUES (?, ?, ?, ?)`
-	updateUserQuery     string = `UPDATE user SET name = ?, email = ?, password = ? WHERE user_id = ?`
+	insertUserQuery     string = `INSERT INTO user (user_id, name, email, email_index, password) VALUES (?, ?, ?, ?, ?)`
+	updateUserQuery     string = `UPDATE user SET name = ?, email = ?, email_index = ?, password = ? WHERE user_id = ?`
 	deleteUserQuery     string = `DELETE FROM user WHERE user_id = ?`
 	selectUserByIdQuery string = `SELECT user_id, name, email, password FROM user WHERE user_id = ?`
 )
 
 type UsersRepository interface {
-	CreateUser(name, email, password string) (*UserEntity, *common.BackendError)
-	UpdateUser(user UserEntity) *common.BackendError
-	GetUsers(where UserWhereClause) (*[]UserEntity, *common.BackendError)
-	GetUsersByName(name string, exactMatch bool) (*[]UserEntity, *common.BackendError)
-	GetUserById(uuid uuid.UUID) (*UserEntity, *common.BackendError)
-	DeleteUser(uuid uuid.UUID) *common.BackendError
+	CreateUser(ctx context.Context, name, email, password string) (*UserEntity, *common.BackendError)
+	UpdateUser(ctx context.Context, user UserEntity) *common.BackendError
+	GetUsers(ctx context.Context, where UserWhereClause) (*[]UserEntity, *common.BackendError)
+	GetUsersByName(ctx context.Context, name string, exactMatch bool) (*[]UserEntity, *common.BackendError)
+	StreamUsers(ctx context.Context, where UserWhereClause) iter.Seq2[UserEntity, error]
+	StreamUsersByName(ctx context.Context, name string, exactMatch bool) iter.Seq2[UserEntity, error]
+	GetUserById(ctx context.Context, uuid uuid.UUID) (*UserEntity, *common.BackendError)
+	// GetUsersByIds returns the users of ids in no particular order, unknown ids are left out.
+	GetUsersByIds(ctx context.Context, ids []uuid.UUID) (*[]UserEntity, *common.BackendError)
+	DeleteUser(ctx context.Context, uuid uuid.UUID) *common.BackendError
 }
 
 type repositoryService struct {
-	db MySqlDatabaseService
+	db        *MySqlDatabaseService
+	encryptor *FieldEncryptor
 }
 
-func NewRepository(db MySqlDatabaseService) UsersRepository {
-	return &repositoryService{db: db}
+// NewRepository creates the users repository. Emails are encrypted at rest with encryptor.
+func NewRepository(db *MySqlDatabaseService, encryptor *FieldEncryptor) UsersRepository {
+	return &repositoryService{db: db, encryptor: encryptor}
 }
 
-func (repo *repositoryService) CreateUser(name, email, password string) (*UserEntity, *common.BackendError) {
+func (repo *repositoryService) CreateUser(ctx context.Context, name, email, password string) (user *UserEntity, berr *common.BackendError) {
+	defer metrics.ObserveDuration(metrics.RepositoryQueryDuration, "CreateUser")()
+	ctx, span := tracing.Start(ctx, "repository.CreateUser", semconv.DBSystemMySQL, semconv.DBQueryText(insertUserQuery))
+	defer func() { tracing.End(span, berr) }()
+
 	cn, berr := repo.db.GetConnection()
 	if berr != nil {
 		return nil, berr
 	}
-	defer cn.Close()
 
 	id := uuid.New()
 	binary, err := common.UuidToBinary(id)
 	if err != nil {
-		return nil, common.NewBackendError(500, "CreateUser.1", "could generate an uuid", err)
+		return nil, common.NewBackendError(500, "CreateUser.1", "could not generate an uuid", err)
+	}
+
+	encryptedEmail, emailIndex, err := repo.encryptEmail(id, email)
+	if err != nil {
+		return nil, common.NewBackendError(500, "CreateUser.4", "could not encrypt email", err)
 	}
 
-	_, err = cn.Exec(insertUserQuery, binary, name, email, password)
+	err = repo.db.Execute(ctx, cn, "CreateUser", false, func() error {
+		_, err := repo.db.execContext(ctx, cn, insertUserQuery, binary, name, encryptedEmail, emailIndex, password)
+		return err
+	})
 	if err != nil {
-		return nil, common.NewBackendError(500, "CreateUser.2", "could not insert user", err)
+		return nil, classifyError(err, common.NewBackendError(500, "CreateUser.2", "could not insert user", err))
 	}
+	// The user may not have reached the replicas yet.
+	ctx = repo.db.MarkWrite(ctx)
 
-	user, berr := repo.GetUserById(id)
+	user, berr = repo.GetUserById(ctx, id)
 	if berr != nil {
 		if berr.Code == 404 {
 			return nil, common.NewBackendError(500, "CreateUser.3", "user not found after insert %s", err, name)
@@ -72,13 +99,16 @@ func (repo *repositoryService) CreateUser(name, email, password string) (*UserEn
 	return user, nil
 }
 
-func (repo *repositoryService) UpdateUser(user UserEntity) *common.BackendError {
+func (repo *repositoryService) UpdateUser(ctx context.Context, user UserEntity) (berr *common.BackendError) {
+	defer metrics.ObserveDuration(metrics.RepositoryQueryDuration, "UpdateUser")()
+	ctx, span := tracing.Start(ctx, "repository.UpdateUser", semconv.DBSystemMySQL, semconv.DBQueryText(updateUserQuery))
+	defer func() { tracing.End(span, berr) }()
+
 	cn, berr := repo.db.GetConnection()
 
 	if berr != nil {
 		return berr
 	}
-	defer cn.Close()
 
 	id, err := common.UuidToBinary(user.Id)
 
@@ -86,11 +116,21 @@ func (repo *repositoryService) UpdateUser(user UserEntity) *common.BackendError
 		return common.NewBackendError(500, "UpdateUser.1", "error converting uuid to binary.", err)
 	}
 
-	result, err := cn.Exec(updateUserQuery, user.Name, user.Email, user.Password, id)
+	encryptedEmail, emailIndex, err := repo.encryptEmail(user.Id, user.Email)
+	if err != nil {
+		return common.NewBackendError(500, "UpdateUser.4", "could not encrypt email", err)
+	}
+
+	var result sql.Result
+	err = repo.db.Execute(ctx, cn, "UpdateUser", true, func() (err error) {
+		result, err = repo.db.execContext(ctx, cn, updateUserQuery, user.Name, encryptedEmail, emailIndex, user.Password, id)
+		return err
+	})
 
 	if err != nil {
-		return common.NewBackendError(500, "UpdateUser.2", "error executing query.", err)
+		return classifyError(err, common.NewBackendError(500, "UpdateUser.2", "error executing query.", err))
 	}
+	repo.db.MarkWrite(ctx)
 
 	rowsAffected, err := result.RowsAffected()
 
@@ -99,73 +139,132 @@ func (repo *repositoryService) UpdateUser(user UserEntity) *common.BackendError
 	}
 
 	if rowsAffected == 0 {
-		log.Println("No rows found")
+		slog.WarnContext(ctx, "no rows updated", "user_id", user.Id)
 		return nil
 	}
 
 	return nil
 }
 
-func (repo *repositoryService) GetUsersByName(name string, exactMatch bool) (*[]UserEntity, *common.BackendError) {
-	cn, berr := repo.db.GetConnection()
-
-	if berr != nil {
-		return nil, berr
-	}
+func (repo *repositoryService) GetUsersByName(ctx context.Context, name string, exactMatch bool) (*[]UserEntity, *common.BackendError) {
+	return collectUsers(repo.queryUsersByName(ctx, "GetUsersByName", name, exactMatch))
+}
 
-	defer cn.Close()
+// StreamUsersByName yields the users named name one by one, see StreamUsers.
+func (repo *repositoryService) StreamUsersByName(ctx context.Context, name string, exactMatch bool) iter.Seq2[UserEntity, error] {
+	return streamUsers(repo.queryUsersByName(ctx, "StreamUsersByName", name, exactMatch))
+}
 
-	var operator string = "="
-	if !exactMatch {
-		operator = "like"
-	}
-	rows, err := cn.Query(fmt.Sprintf("SELECT user_id, name, email, password FROM user WHERE name %s ?", operator), name)
+func (repo *repositoryService) queryUsersByName(ctx context.Context, operation, name string, exactMatch bool) iter.Seq2[UserEntity, *common.BackendError] {
+	return func(yield func(UserEntity, *common.BackendError) bool) {
+		var berr *common.BackendError
+		defer metrics.ObserveDuration(metrics.RepositoryQueryDuration, operation)()
+		ctx, span := tracing.Start(ctx, "repository."+operation, semconv.DBSystemMySQL)
+		defer func() { tracing.End(span, berr) }()
+		fail := func(err *common.BackendError) {
+			berr = err
+			yield(UserEntity{}, berr)
+		}
 
-	if err != nil {
-		return nil, common.NewBackendError(500, "GetUserByName.1", "error querying user by name %s.", err, name)
-	}
+		cn, berr := repo.db.GetReadConnection(ctx)
+		if berr != nil {
+			fail(berr)
+			return
+		}
 
-	users := make([]UserEntity, 0)
-	for rows.Next() {
-		var id []byte
-		var email, password string
-		err = rows.Scan(&id, &name, &email, &password)
+		condition := Like("name", name)
+		if exactMatch {
+			condition = Eq("name", name)
+		}
+		query, values, err := selectUsers(condition)
 		if err != nil {
-			return nil, common.NewBackendError(500, "GetUserByName.2", "error reading row.", err, name)
+			fail(common.NewBackendError(500, "GetUserByName.5", "could not build query.", err))
+			return
 		}
-
-		uuid, err := uuid.FromBytes(id)
+		span.SetAttributes(semconv.DBQueryText(query))
+		var rows *sql.Rows
+		err = repo.db.Execute(ctx, cn, operation, true, func() (err error) {
+			rows, err = repo.db.queryContext(ctx, cn, query, values...)
+			return err
+		})
 
 		if err != nil {
-			return nil, common.NewBackendError(500, "GetUserByName.3", "error parsing user id to uuid.", err)
+			fail(classifyError(err, common.NewBackendError(500, "GetUserByName.1", "error querying user by name %s.", err, name)))
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id []byte
+			var userName, email, password string
+			err = rows.Scan(&id, &userName, &email, &password)
+			if err != nil {
+				fail(common.NewBackendError(500, "GetUserByName.2", "error reading row.", err, name))
+				return
+			}
+
+			uuid, err := uuid.FromBytes(id)
+
+			if err != nil {
+				fail(common.NewBackendError(500, "GetUserByName.3", "error parsing user id to uuid.", err))
+				return
+			}
+
+			email, err = repo.decryptEmail(uuid, email)
+			if err != nil {
+				fail(common.NewBackendError(500, "GetUserByName.4", "could not decrypt email.", err))
+				return
+			}
+
+			if !yield(UserEntity{Id: uuid, Name: userName, Email: email, Password: password}, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			fail(classifyError(err, common.NewBackendError(500, "GetUserByName.2", "error reading row.", err, name)))
 		}
-
-		users = append(users, UserEntity{Id: uuid, Name: name, Email: email, Password: password})
 	}
+}
 
-	return &users, nil
-
+// decryptEmail decrypts a stored email. Emails stored before they were encrypted are returned as
+// they are, until the re-encryption job encrypts them and fills their blind index.
+func (repo *repositoryService) decryptEmail(id uuid.UUID, stored string) (string, error) {
+	if !common.IsKeyringCiphertext(stored) {
+		return stored, nil
+	}
+	return repo.encryptor.Decrypt(userEmailColumn, id, stored)
 }
 
-func (repo *repositoryService) GetUserById(id uuid.UUID) (*UserEntity, *common.BackendError) {
-	cn, berr := repo.db.GetConnection()
+func (repo *repositoryService) GetUserById(ctx context.Context, id uuid.UUID) (user *UserEntity, berr *common.BackendError) {
+	defer metrics.ObserveDuration(metrics.RepositoryQueryDuration, "GetUserById")()
+	ctx, span := tracing.Start(ctx, "repository.GetUserById", semconv.DBSystemMySQL, semconv.DBQueryText(selectUserByIdQuery))
+	defer func() { tracing.End(span, berr) }()
+
+	cn, berr := repo.db.GetReadConnection(ctx)
 	if berr != nil {
 		return nil, berr
 	}
-	defer cn.Close()
 
 	binary, err := common.UuidToBinary(id)
 	if err != nil {
 		return nil, common.NewBackendError(500, "GetUserById.1", "converting uuid %s.", err, id.String())
 	}
 
-	rows, err := cn.Query(selectUserByIdQuery, binary)
+	var rows *sql.Rows
+	err = repo.db.Execute(ctx, cn, "GetUserById", true, func() (err error) {
+		rows, err = repo.db.queryContext(ctx, cn, selectUserByIdQuery, binary)
+		return err
+	})
 	if err != nil {
-		return nil, common.NewBackendError(500, "GetUserById.2", "error querying user by id %s.", err, id.String())
+		return nil, classifyError(err, common.NewBackendError(500, "GetUserById.2", "error querying user by id %s.", err, id.String()))
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
+		// A canceled query also ends the rows, it must not look like a missing user.
+		if err := rows.Err(); err != nil {
+			return nil, classifyError(err, common.NewBackendError(500, "GetUserById.4", "error reading row.", err))
+		}
 		return nil, common.NewBackendError(404, "GetUserById.3", "user not found for id %s", nil, id.String())
 	}
 
@@ -180,72 +279,163 @@ func (repo *repositoryService) GetUserById(id uuid.UUID) (*UserEntity, *common.B
 		return nil, common.NewBackendError(500, "GetUserById.5", "error parsing user id to uuid.", err)
 	}
 
+	email, err = repo.decryptEmail(uuid, email)
+	if err != nil {
+		return nil, common.NewBackendError(500, "GetUserById.6", "could not decrypt email.", err)
+	}
+
 	return &UserEntity{Id: uuid, Name: name, Email: email, Password: password}, nil
 }
 
-func (repo *repositoryService) GetUsers(where UserWhereClause) (*[]UserEntity, *common.BackendError) {
-	users := make([]UserEntity, 0)
-	cn, berr := repo.db.GetConnection()
-
-	if berr != nil {
-		return nil, berr
-	}
+func (repo *repositoryService) GetUsers(ctx context.Context, where UserWhereClause) (*[]UserEntity, *common.BackendError) {
+	return collectUsers(repo.queryUsers(ctx, "GetUsers", where))
+}
 
-	defer cn.Close()
-	query := "SELECT user_id, name, email, password FROM user "
-	clause, values := buildWhereClause(where)
-	if len(clause) > 0 {
-		query += " WHERE " + clause
-	}
+// StreamUsers yields the users matching where one by one, so a large result is never held in
+// memory. A connection and its cursor stay open until the iteration ends, and each iteration
+// runs the query again.
+func (repo *repositoryService) StreamUsers(ctx context.Context, where UserWhereClause) iter.Seq2[UserEntity, error] {
+	return streamUsers(repo.queryUsers(ctx, "StreamUsers", where))
+}
 
-	rows, err := cn.Query(query, values...)
+func (repo *repositoryService) queryUsers(ctx context.Context, operation string, where UserWhereClause) iter.Seq2[UserEntity, *common.BackendError] {
+	return func(yield func(UserEntity, *common.BackendError) bool) {
+		var berr *common.BackendError
+		defer metrics.ObserveDuration(metrics.RepositoryQueryDuration, operation)()
+		ctx, span := tracing.Start(ctx, "repository."+operation, semconv.DBSystemMySQL)
+		defer func() { tracing.End(span, berr) }()
+		fail := func(err *common.BackendError) {
+			berr = err
+			yield(UserEntity{}, berr)
+		}
 
-	if err != nil {
-		return &[]UserEntity{}, common.NewBackendError(500, "GetUsers.1", "could not execute query.", err)
-	}
+		cn, berr := repo.db.GetReadConnection(ctx)
+		if berr != nil {
+			fail(berr)
+			return
+		}
 
-	defer rows.Close()
+		var emailIndex []byte
+		if len(where.Email) > 0 {
+			var err error
+			emailIndex, err = repo.encryptor.BlindIndex(userEmailColumn, normalizeEmail(where.Email))
+			if err != nil {
+				fail(common.NewBackendError(500, "GetUsers.5", "could not compute email index.", err))
+				return
+			}
+		}
 
-	for rows.Next() {
-		var id []byte
-		var name, email, password string
-		err := rows.Scan(&id, &name, &email, &password)
+		condition, err := userWhereCondition(where, emailIndex)
 		if err != nil {
-			log.Fatal(err)
+			fail(common.NewBackendError(500, "GetUsers.6", "could not convert uuid to binary.", err))
+			return
+		}
+		query, values, err := selectUsers(condition)
+		if err != nil {
+			fail(common.NewBackendError(500, "GetUsers.7", "could not build query.", err))
+			return
 		}
 
-		uuid, err := uuid.FromBytes(id)
+		slog.DebugContext(ctx, "querying users", "query", query)
+		span.SetAttributes(semconv.DBQueryText(query))
+		var rows *sql.Rows
+		err = repo.db.Execute(ctx, cn, operation, true, func() (err error) {
+			rows, err = repo.db.queryContext(ctx, cn, query, values...)
+			return err
+		})
 
 		if err != nil {
-			log.Fatal(err)
-			return &[]UserEntity{}, common.NewBackendError(500, "GetUsers.2", "could not parse id to uuid.", err)
+			fail(classifyError(err, common.NewBackendError(500, "GetUsers.1", "could not execute query.", err)))
+			return
 		}
 
-		users = append(users, UserEntity{Id: uuid, Name: name, Email: email, Password: password})
+		defer rows.Close()
+
+		for rows.Next() {
+			var id []byte
+			var name, email, password string
+			err := rows.Scan(&id, &name, &email, &password)
+			if err != nil {
+				fail(common.NewBackendError(500, "GetUsers.3", "error reading row.", err))
+				return
+			}
+
+			uuid, err := uuid.FromBytes(id)
+
+			if err != nil {
+				fail(common.NewBackendError(500, "GetUsers.2", "could not parse id to uuid.", err))
+				return
+			}
+
+			email, err = repo.decryptEmail(uuid, email)
+			if err != nil {
+				fail(common.NewBackendError(500, "GetUsers.4", "could not decrypt email.", err))
+				return
+			}
+
+			if !yield(UserEntity{Id: uuid, Name: name, Email: email, Password: password}, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			fail(classifyError(err, common.NewBackendError(500, "GetUsers.3", "error reading row.", err)))
+		}
 	}
+}
 
-	return &users, nil
+// collectUsers reads every user of users, stopping at the first error.
+func collectUsers(users iter.Seq2[UserEntity, *common.BackendError]) (*[]UserEntity, *common.BackendError) {
+	collected := make([]UserEntity, 0)
+	for user, berr := range users {
+		if berr != nil {
+			return nil, berr
+		}
+		collected = append(collected, user)
+	}
+	return &collected, nil
+}
+
+// streamUsers exposes users with plain errors, a nil *BackendError must not become a non-nil error.
+func streamUsers(users iter.Seq2[UserEntity, *common.BackendError]) iter.Seq2[UserEntity, error] {
+	return func(yield func(UserEntity, error) bool) {
+		for user, berr := range users {
+			if berr != nil {
+				yield(UserEntity{}, berr)
+				return
+			}
+			if !yield(user, nil) {
+				return
+			}
+		}
+	}
 }
 
-func (repo *repositoryService) DeleteUser(uuid uuid.UUID) *common.BackendError {
+func (repo *repositoryService) DeleteUser(ctx context.Context, uuid uuid.UUID) (berr *common.BackendError) {
+	defer metrics.ObserveDuration(metrics.RepositoryQueryDuration, "DeleteUser")()
+	ctx, span := tracing.Start(ctx, "repository.DeleteUser", semconv.DBSystemMySQL, semconv.DBQueryText(deleteUserQuery))
+	defer func() { tracing.End(span, berr) }()
+
 	cn, berr := repo.db.GetConnection()
 
 	if berr != nil {
 		return berr
 	}
 
-	defer cn.Close()
-
 	id, err := common.UuidToBinary(uuid)
 
 	if err != nil {
 		return common.NewBackendError(500, "DeleteUser.1", "cannot parse id to uuid", err)
 	}
 
-	result, err := cn.Exec(deleteUserQuery, id)
+	var result sql.Result
+	err = repo.db.Execute(ctx, cn, "DeleteUser", true, func() (err error) {
+		result, err = repo.db.execContext(ctx, cn, deleteUserQuery, id)
+		return err
+	})
 	if err != nil {
-		return common.NewBackendError(500, "DeleteUser.2", "cannot execute query", err)
+		return classifyError(err, common.NewBackendError(500, "DeleteUser.2", "cannot execute query", err))
 	}
+	repo.db.MarkWrite(ctx)
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -253,45 +443,105 @@ func (repo *repositoryService) DeleteUser(uuid uuid.UUID) *common.BackendError {
 	}
 
 	if rowsAffected == 0 {
-		log.Println("No rows deleted. UUID may not exist.")
+		slog.WarnContext(ctx, "no rows deleted, user may not exist", "user_id", uuid)
 	}
 
 	return nil
 }
 
-func buildWhereClause(where UserWhereClause) (string, []interface{}) {
-	var builder strings.Builder
-	var values []interface{}
-	conditions := 0
-
-	addCondition := func(clause string, value interface{}) {
-		if conditions > 0 {
-			builder.WriteString(" AND ")
+// maxBatchSize is the largest number of ids looked up by one query.
+const maxBatchSize = 128
+
+// GetUsersByIds queries the users of ids by batches of at most maxBatchSize.
+func (repo *repositoryService) GetUsersByIds(ctx context.Context, ids []uuid.UUID) (*[]UserEntity, *common.BackendError) {
+	ids = uniqueIds(ids)
+	users := make([]UserEntity, 0, len(ids))
+	for start := 0; start < len(ids); start += maxBatchSize {
+		batch, berr := repo.GetUsers(ctx, UserWhereClause{Ids: ids[start:min(start+maxBatchSize, len(ids))]})
+		if berr != nil {
+			return nil, berr
 		}
-		builder.WriteString(clause)
-		if value != nil {
-			values = append(values, value)
+		users = append(users, *batch...)
+	}
+	return &users, nil
+}
+
+func uniqueIds(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
 		}
-		conditions++
 	}
+	return unique
+}
+
+// placeholderCount rounds count up to a power of two, so lists of ids of any size share a few
+// prepared statements.
+func placeholderCount(count int) int {
+	padded := 1
+	for padded < count {
+		padded *= 2
+	}
+	return padded
+}
 
-	// Add conditions for IDs
+// userColumns are the columns of a UserEntity, in Scan order.
+var userColumns = []Column{"user_id", "name", "email", "password"}
+
+func selectUsers(condition Condition) (string, []any, error) {
+	return Select(userColumns...).From("user").Where(condition).Build(MySQL)
+}
+
+// userWhereCondition returns the conditions of where, nil when there is none. Emails are
+// encrypted, so they are matched exactly through emailIndex, their blind index.
+func userWhereCondition(where UserWhereClause, emailIndex []byte) (Condition, error) {
+	var conditions []Condition
+
+	// The list of ids is padded with its last id
 	if len(where.Ids) > 0 {
-		placeholders := strings.Repeat("?, ", len(where.Ids))
-		placeholders = placeholders[:len(placeholders)-2] // Remove trailing ", "
-		addCondition(fmt.Sprintf("user_id IN (%s)", placeholders), nil)
-		values = append(values, where.Ids)
+		ids := make([]any, placeholderCount(len(where.Ids)))
+		for i := range ids {
+			binary, err := common.UuidToBinary(where.Ids[min(i, len(where.Ids)-1)])
+			if err != nil {
+				return nil, err
+			}
+			ids[i] = binary
+		}
+		conditions = append(conditions, In("user_id", ids...))
 	}
 
-	// Add condition for Name
 	if len(where.Name) > 0 {
-		addCondition("name LIKE ?", where.Name)
+		conditions = append(conditions, Like("name", where.Name))
 	}
 
-	// Add condition for Email
-	if len(where.Email) > 0 {
-		addCondition("email LIKE ?", where.Email)
+	if len(emailIndex) > 0 {
+		conditions = append(conditions, Eq("email_index", emailIndex))
 	}
 
-	return builder.String(), values
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	return And(conditions...), nil
+}
+
+func (repo *repositoryService) encryptEmail(id uuid.UUID, email string) (encrypted string, index []byte, err error) {
+	encrypted, err = repo.encryptor.Encrypt(userEmailColumn, id, email)
+	if err != nil {
+		return "", nil, err
+	}
+
+	index, err = repo.encryptor.BlindIndex(userEmailColumn, normalizeEmail(email))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return encrypted, index, nil
+}
+
+// normalizeEmail makes emails differing only by case or surrounding spaces share a blind index.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
@@ -1,18 +1,30 @@
 package database
 
 import (
+	"backend-sample/common"
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"os"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 )
 
 var repo repositoryService
 var sqlCnMock sqlmock.Sqlmock
 
+var testFieldEncryption = FieldEncryptionConfiguration{
+	ActiveKey: "v1",
+	Keys:      []common.KeyConfiguration{{Id: "v1", Value: "LefWEePuYpZb+lVpb+3XwJDj/uuyluNWeE8RI08fiCM="}},
+	IndexKey:  "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+}
+
 func TestMain(m *testing.M) {
 	var err error
 	var db *sql.DB
@@ -21,8 +33,12 @@ func TestMain(m *testing.M) {
 		panic(fmt.Sprintf("an error '%s' was not expected when opening a stub database connection", err))
 	}
 	defer db.Close()
-	mdb := MySqlDatabaseService{dbConfig, db}
-	repo = repositoryService{mdb}
+	mdb := &MySqlDatabaseService{Configuration: dbConfig, db: db}
+	encryptor, err := NewFieldEncryptor(testFieldEncryption)
+	if err != nil {
+		panic(err)
+	}
+	repo = repositoryService{db: mdb, encryptor: encryptor}
 	err = db.Ping()
 
 	if err != nil {
@@ -34,44 +50,97 @@ func TestMain(m *testing.M) {
 	os.Exit(result)
 }
 
+// resetStatements forgets the statements prepared by the previous tests, so each test expects
+// the prepares of its own queries.
+func resetStatements(t *testing.T) {
+	t.Helper()
+	if err := repo.db.statements.close(); err != nil {
+		t.Fatalf("could not close statements: %s", err)
+	}
+}
+
+func newUserIdBytes() []byte {
+	id := uuid.New()
+	return id[:]
+}
+
+func newUserRowArgs(t *testing.T, email string) []driver.Value {
+	t.Helper()
+	id, encrypted := newUserRow(t, email)
+	return []driver.Value{id, "John Doe", encrypted, "password"}
+}
+
+// newUserRow returns the id and encrypted email of a user row, as stored in the database.
+func newUserRow(t *testing.T, email string) ([]byte, string) {
+	t.Helper()
+	id := uuid.New()
+	encrypted, err := repo.encryptor.Encrypt(userEmailColumn, id, email)
+	if err != nil {
+		t.Fatalf("could not encrypt email: %s", err)
+	}
+	return id[:], encrypted
+}
+
 func Test_CreateUser_ExpectSuccess(t *testing.T) {
-	sqlCnMock.ExpectExec("INSERT INTO user").
-		WithArgs(sqlmock.AnyArg(), "John Doe", "john@example.com", "password").
+	resetStatements(t)
+	emailIndex, _ := repo.encryptor.BlindIndex(userEmailColumn, "john@example.com")
+	sqlCnMock.ExpectPrepare("INSERT INTO user").ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "John Doe", sqlmock.AnyArg(), emailIndex, "password").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	sqlCnMock.ExpectQuery("SELECT user_id, name, email, pasword FROM user WHERE user_id = ?").
+	id, email := newUserRow(t, "John@Example.com")
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("SELECT user_id, name, email, password FROM user WHERE user_id = ?")).ExpectQuery().
 		WithArgs(sqlmock.AnyArg()).
 		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "password"}).
-			AddRow([]byte{1, 2, 3, 4}, "John Doe", "john@example.com", "password"))
+			AddRow(id, "John Doe", email, "password"))
 
-	user, err := repo.CreateUser("John Doe", "john@example.com", "password")
+	user, err := repo.CreateUser(context.Background(), "John Doe", " John@Example.com", "password")
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
 	}
 
+	if user.Email != "John@Example.com" {
+		t.Errorf("expected decrypted email 'John@Example.com', got '%s'", user.Email)
+	}
+
 	if user.Name != "John Doe" {
 		t.Errorf("expected user name to be 'John Doe', got '%s'", user.Name)
 	}
 }
 
+func Test_CreateUser_DuplicateEmail_ExpectConflict(t *testing.T) {
+	resetStatements(t)
+	sqlCnMock.ExpectPrepare("INSERT INTO user").ExpectExec().
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '...' for key 'user.user_email_index'"})
+
+	_, err := repo.CreateUser(context.Background(), "John Doe", "john@example.com", "password")
+
+	if err == nil || err.Code != 409 || err.Identifier != "ClassifyError.1" {
+		t.Errorf("expected email already registered conflict, got %v", err)
+	}
+}
+
 func Test_UpdateUser_ExpectSuccess(t *testing.T) {
-	sqlCnMock.ExpectExec("UPDATE user SET name = ?, email = ?, password = ? WHERE user_id = ?").
-		WithArgs("John Doe", "john@example.com", "newpassword", sqlmock.AnyArg()).
+	resetStatements(t)
+	emailIndex, _ := repo.encryptor.BlindIndex(userEmailColumn, "john@example.com")
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("UPDATE user SET name = ?, email = ?, email_index = ?, password = ? WHERE user_id = ?")).ExpectExec().
+		WithArgs("John Doe", sqlmock.AnyArg(), emailIndex, "newpassword", sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := repo.UpdateUser(UserEntity{Id: uuid.New(), Name: "John Doe", Email: "john@example.com", Password: "newpassword"})
+	err := repo.UpdateUser(context.Background(), UserEntity{Id: uuid.New(), Name: "John Doe", Email: "john@example.com", Password: "newpassword"})
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
 	}
 }
 
 func Test_GetUsersByName_ExpectSuccess(t *testing.T) {
-	sqlCnMock.ExpectQuery("SELECT user_id, name, email, pasword FROM user WHERE name = ?").
+	resetStatements(t)
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("SELECT `user_id`, `name`, `email`, `password` FROM `user` WHERE `name` = ?")).ExpectQuery().
 		WithArgs("John Doe").
 		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "password"}).
-			AddRow([]byte{1, 2, 3, 4}, "John Doe", "john@example.com", "password"))
+			AddRow(newUserRowArgs(t, "john@example.com")...))
 
-	users, err := repo.GetUsersByName("John Doe", true)
+	users, err := repo.GetUsersByName(context.Background(), "John Doe", true)
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
 	}
@@ -82,12 +151,13 @@ func Test_GetUsersByName_ExpectSuccess(t *testing.T) {
 }
 
 func Test_GetUserById_ExpectSuccess(t *testing.T) {
-	sqlCnMock.ExpectQuery("SELECT user_id, name, email, pasword FROM user WHERE user_id = ?").
+	resetStatements(t)
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("SELECT user_id, name, email, password FROM user WHERE user_id = ?")).ExpectQuery().
 		WithArgs(sqlmock.AnyArg()).
 		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "password"}).
-			AddRow([]byte{1, 2, 3, 4}, "John Doe", "john@example.com", "password"))
+			AddRow(newUserRowArgs(t, "john@example.com")...))
 
-	user, err := repo.GetUserById(uuid.New())
+	user, err := repo.GetUserById(context.Background(), uuid.New())
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
 	}
@@ -95,17 +165,172 @@ func Test_GetUserById_ExpectSuccess(t *testing.T) {
 	if user.Name != "John Doe" {
 		t.Errorf("expected user name to be 'John Doe', got '%s'", user.Name)
 	}
+
+	if user.Email != "john@example.com" {
+		t.Errorf("expected decrypted email 'john@example.com', got '%s'", user.Email)
+	}
+}
+
+func Test_GetUserById_Canceled_Expect499(t *testing.T) {
+	resetStatements(t)
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("SELECT user_id, name, email, password FROM user WHERE user_id = ?")).ExpectQuery().
+		WithArgs(sqlmock.AnyArg()).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "password"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := repo.GetUserById(ctx, uuid.New())
+	if err == nil || err.Code != 504 || err.Identifier != "ClassifyError.8" {
+		t.Errorf("expected ClassifyError.8 with 504, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = repo.GetUsers(ctx, UserWhereClause{})
+	if err == nil || err.Code != 499 {
+		t.Errorf("expected a 499 error, got %v", err)
+	}
+}
+
+func Test_GetUserById_EmailOfAnotherRow_ExpectError(t *testing.T) {
+	resetStatements(t)
+	_, email := newUserRow(t, "john@example.com")
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("SELECT user_id, name, email, password FROM user WHERE user_id = ?")).ExpectQuery().
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "password"}).
+			AddRow(newUserIdBytes(), "John Doe", email, "password"))
+
+	_, err := repo.GetUserById(context.Background(), uuid.New())
+	if err == nil || err.Identifier != "GetUserById.6" {
+		t.Errorf("expected GetUserById.6 error, got %v", err)
+	}
+}
+
+func Test_GetUserById_PlaintextEmail_ExpectEmailAsStored(t *testing.T) {
+	resetStatements(t)
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("SELECT user_id, name, email, password FROM user WHERE user_id = ?")).ExpectQuery().
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "password"}).
+			AddRow(newUserIdBytes(), "John Doe", "john@example.com", "password"))
+
+	user, err := repo.GetUserById(context.Background(), uuid.New())
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if user.Email != "john@example.com" {
+		t.Errorf("expected email 'john@example.com', got '%s'", user.Email)
+	}
+}
+
+func Test_GetUsers_ByEmail_UsesBlindIndex(t *testing.T) {
+	resetStatements(t)
+	emailIndex, _ := repo.encryptor.BlindIndex(userEmailColumn, "john@example.com")
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("SELECT `user_id`, `name`, `email`, `password` FROM `user` WHERE `email_index` = ?")).ExpectQuery().
+		WithArgs(emailIndex).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "password"}).
+			AddRow(newUserRowArgs(t, "john@example.com")...))
+
+	users, err := repo.GetUsers(context.Background(), UserWhereClause{Email: "JOHN@example.com "})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if len(*users) != 1 || (*users)[0].Email != "john@example.com" {
+		t.Errorf("expected the user with the decrypted email, got %v", *users)
+	}
 }
 
 func Test_DeleteUser_ExpectSuccess(t *testing.T) {
-	sqlCnMock.ExpectExec("DELETE FROM user WHERE user_id = ?").
+	resetStatements(t)
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM user WHERE user_id = ?")).ExpectExec().
 		WithArgs(sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := repo.DeleteUser(uuid.New())
+	err := repo.DeleteUser(context.Background(), uuid.New())
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
 	}
 }
 
+func Test_GetUsersByIds_ExpectOneArgumentPerId(t *testing.T) {
+	resetStatements(t)
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	args := make([]driver.Value, 0, 4)
+	for _, id := range append(ids, ids[2]) {
+		args = append(args, id[:])
+	}
+	columns := []string{"user_id", "name", "email", "password"}
+	query := regexp.QuoteMeta("SELECT `user_id`, `name`, `email`, `password` FROM `user` WHERE `user_id` IN (?, ?, ?, ?)")
+	sqlCnMock.ExpectPrepare(query).ExpectQuery().
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(newUserRowArgs(t, "john@example.com")...))
+	// The statement prepared by the first call is reused.
+	sqlCnMock.ExpectQuery(query).
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	users, err := repo.GetUsersByIds(context.Background(), append(ids, ids[0]))
+	if err != nil || len(*users) != 1 {
+		t.Errorf("expected 1 user, got %v and error %v", users, err)
+	}
+	users, err = repo.GetUsersByIds(context.Background(), ids)
+	if err != nil || len(*users) != 0 {
+		t.Errorf("expected no user, got %v and error %v", users, err)
+	}
+
+	if err := sqlCnMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+func Test_PlaceholderCount_ExpectPowerOfTwo(t *testing.T) {
+	for count, expected := range map[int]int{1: 1, 2: 2, 3: 4, 5: 8, 64: 64, 65: 128, maxBatchSize: maxBatchSize} {
+		if padded := placeholderCount(count); padded != expected {
+			t.Errorf("expected %d placeholders for %d ids, got %d", expected, count, padded)
+		}
+	}
+}
 
+func Test_StreamUsers_Break_ExpectRowsClosed(t *testing.T) {
+	resetStatements(t)
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("SELECT `user_id`, `name`, `email`, `password` FROM `user` WHERE `name` LIKE ?")).ExpectQuery().
+		WithArgs("J%").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "name", "email", "password"}).
+			AddRow(newUserRowArgs(t, "john@example.com")...).
+			AddRow(newUserRowArgs(t, "jane@example.com")...)).
+		RowsWillBeClosed()
+
+	var emails []string
+	for user, err := range repo.StreamUsersByName(context.Background(), "J%", false) {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		emails = append(emails, user.Email)
+		break
+	}
+
+	if len(emails) != 1 || emails[0] != "john@example.com" {
+		t.Errorf("expected only the first user, got %v", emails)
+	}
+	if err := sqlCnMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %s", err)
+	}
+}
+
+func Test_StreamUsers_QueryFails_ExpectSingleError(t *testing.T) {
+	resetStatements(t)
+	sqlCnMock.ExpectPrepare(regexp.QuoteMeta("SELECT `user_id`, `name`, `email`, `password` FROM `user`") + "$").ExpectQuery().
+		WillReturnError(&mysql.MySQLError{Number: 1146, Message: "Table doesn't exist"})
+
+	count := 0
+	for _, err := range repo.StreamUsers(context.Background(), UserWhereClause{}) {
+		count++
+		berr, ok := err.(*common.BackendError)
+		if !ok || berr.Identifier != "GetUsers.1" {
+			t.Errorf("expected GetUsers.1 error, got %v", err)
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected a single error, got %d items", count)
+	}
+}
@@ -0,0 +1,51 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Check_AllUp_ExpectUp(t *testing.T) {
+	registry := NewRegistry(time.Second)
+	registry.Register("database", CheckerFunc(func(ctx context.Context) error { return nil }))
+	registry.Register("cache", CheckerFunc(func(ctx context.Context) error { return nil }))
+
+	report := registry.Check(context.Background())
+
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Len(t, report.Checks, 2)
+	assert.Equal(t, "cache", report.Checks[0].Name)
+	assert.Equal(t, "database", report.Checks[1].Name)
+}
+
+func Test_Check_FailingChecker_ExpectDown(t *testing.T) {
+	registry := NewRegistry(time.Second)
+	registry.Register("database", CheckerFunc(func(ctx context.Context) error { return errors.New("connection refused") }))
+	registry.Register("cache", CheckerFunc(func(ctx context.Context) error { return nil }))
+
+	report := registry.Check(context.Background())
+
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, StatusUp, report.Checks[0].Status)
+	assert.Equal(t, StatusDown, report.Checks[1].Status)
+	assert.Equal(t, "connection refused", report.Checks[1].Error)
+}
+
+func Test_Check_SlowChecker_ExpectTimeout(t *testing.T) {
+	registry := NewRegistry(10 * time.Millisecond)
+	registry.Register("database", CheckerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+
+	start := time.Now()
+	report := registry.Check(context.Background())
+
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks[0].Error)
+}
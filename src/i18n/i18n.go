@@ -0,0 +1,191 @@
+package i18n
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+// Fallback is the language of the messages written in the code, used when no other matches.
+var Fallback = language.English
+
+//go:embed locales/*.yml
+var embeddedLocales embed.FS
+
+var errFallbackMissing = fmt.Errorf("locale %s is required", Fallback)
+
+type LocalizationConfiguration struct {
+	// Path is a directory of <language>.yml files replacing the built-in ones, empty to use these.
+	Path string `json:"path" yaml:"path"`
+}
+
+// Catalog holds the messages of one language, keyed by BackendError identifier, the titles
+// of problem types, keyed by type URI, and the messages of validation rules, keyed by rule name.
+type Catalog struct {
+	Titles   map[string]string `yaml:"titles"`
+	Messages map[string]string `yaml:"messages"`
+	Rules    map[string]string `yaml:"rules"`
+}
+
+// Bundle holds the catalogs of every supported language.
+type Bundle struct {
+	tags     []language.Tag
+	catalogs map[language.Tag]Catalog
+	matcher  language.Matcher
+}
+
+var current atomic.Pointer[Bundle]
+
+func init() {
+	bundle, err := NewBundle(embeddedLocales)
+	if err != nil {
+		panic(err)
+	}
+	SetBundle(bundle)
+}
+
+// SetBundle replaces the bundle used to localize responses.
+func SetBundle(bundle *Bundle) {
+	current.Store(bundle)
+}
+
+func CurrentBundle() *Bundle {
+	return current.Load()
+}
+
+// Load returns the bundle configured, the built-in one when no path is set.
+func Load(config LocalizationConfiguration) (*Bundle, error) {
+	if config.Path == "" {
+		return NewBundle(embeddedLocales)
+	}
+	return NewBundle(os.DirFS(config.Path))
+}
+
+// NewBundle reads every <language>.yml file of fsys, at its root or in a locales directory.
+func NewBundle(fsys fs.FS) (*Bundle, error) {
+	files, err := fs.Glob(fsys, "locales/*.yml")
+	if err == nil && len(files) == 0 {
+		files, err = fs.Glob(fsys, "*.yml")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &Bundle{catalogs: make(map[language.Tag]Catalog, len(files))}
+	var errs []error
+	for _, file := range files {
+		tag, err := language.Parse(strings.TrimSuffix(path.Base(file), ".yml"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var catalog Catalog
+		if err := yaml.Unmarshal(content, &catalog); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+		bundle.catalogs[tag] = catalog
+		bundle.tags = append(bundle.tags, tag)
+	}
+	if _, ok := bundle.catalogs[Fallback]; !ok {
+		errs = append(errs, errFallbackMissing)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	// The first tag is the matcher default, so it must be the fallback.
+	tags := []language.Tag{Fallback}
+	for _, tag := range bundle.tags {
+		if tag != Fallback {
+			tags = append(tags, tag)
+		}
+	}
+	bundle.tags = tags
+	bundle.matcher = language.NewMatcher(tags)
+
+	return bundle, nil
+}
+
+// Languages returns the supported languages, the fallback first.
+func (b *Bundle) Languages() []language.Tag {
+	return append([]language.Tag(nil), b.tags...)
+}
+
+// Match returns the supported language preferred by an Accept-Language header.
+func (b *Bundle) Match(acceptLanguage string) language.Tag {
+	preferred, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(preferred) == 0 {
+		return Fallback
+	}
+	_, index, _ := b.matcher.Match(preferred...)
+	return b.tags[index]
+}
+
+// Message formats the message of identifier with args, looking it up in tag, its parents and
+// then the fallback language. It reports false when no catalog has it.
+func (b *Bundle) Message(tag language.Tag, identifier string, args ...any) (string, bool) {
+	format, ok := b.lookup(tag, func(catalog Catalog) (string, bool) {
+		message, ok := catalog.Messages[identifier]
+		return message, ok
+	})
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf(format, args...), true
+}
+
+// Title returns the title of a problem type, with the same fallbacks as Message.
+func (b *Bundle) Title(tag language.Tag, problemType string) (string, bool) {
+	return b.lookup(tag, func(catalog Catalog) (string, bool) {
+		title, ok := catalog.Titles[problemType]
+		return title, ok
+	})
+}
+
+// Rule formats the message of a validation rule violation with the rule parameter, with the same
+// fallbacks as Message.
+func (b *Bundle) Rule(tag language.Tag, rule, param string) (string, bool) {
+	format, ok := b.lookup(tag, func(catalog Catalog) (string, bool) {
+		message, ok := catalog.Rules[rule]
+		return message, ok
+	})
+	if !ok {
+		return "", false
+	}
+	if !strings.Contains(format, "%") {
+		return format, true
+	}
+	return fmt.Sprintf(format, param), true
+}
+
+func (b *Bundle) lookup(tag language.Tag, find func(Catalog) (string, bool)) (string, bool) {
+	for ; ; tag = tag.Parent() {
+		if catalog, ok := b.catalogs[tag]; ok {
+			if value, ok := find(catalog); ok {
+				return value, true
+			}
+		}
+		if tag == language.Und {
+			break
+		}
+	}
+
+	value, ok := find(b.catalogs[Fallback])
+	return value, ok
+}
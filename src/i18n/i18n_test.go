@@ -0,0 +1,97 @@
+package i18n
+
+import (
+	"backend-sample/common"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func Test_Bundle_Match(t *testing.T) {
+	bundle := CurrentBundle()
+
+	tests := map[string]language.Tag{
+		"":                        language.English,
+		"pt-BR,pt;q=0.9,en;q=0.8": language.Portuguese,
+		"es-419":                  language.Spanish,
+		"fr-FR, es;q=0.5":         language.Spanish,
+		"fr":                      language.English,
+		"not a language;;":        language.English,
+	}
+	for header, expected := range tests {
+		assert.Equal(t, expected, bundle.Match(header), header)
+	}
+}
+
+func Test_Bundle_Message_InterpolatesAndFallsBack(t *testing.T) {
+	bundle, err := NewBundle(fstest.MapFS{
+		"en.yml": {Data: []byte("messages:\n  A.1: \"user %s not found\"\n  A.2: \"only in english\"\n")},
+		"pt.yml": {Data: []byte("messages:\n  A.1: \"usuário %s não encontrado\"\n")},
+	})
+	assert.NoError(t, err)
+
+	message, ok := bundle.Message(language.MustParse("pt-BR"), "A.1", "42")
+	assert.True(t, ok)
+	assert.Equal(t, "usuário 42 não encontrado", message)
+
+	message, ok = bundle.Message(language.Portuguese, "A.2")
+	assert.True(t, ok)
+	assert.Equal(t, "only in english", message)
+
+	_, ok = bundle.Message(language.Portuguese, "A.3")
+	assert.False(t, ok)
+}
+
+func Test_NewBundle_WithoutFallback_ExpectError(t *testing.T) {
+	_, err := NewBundle(fstest.MapFS{"pt.yml": {Data: []byte("messages: {}\n")}})
+
+	assert.ErrorIs(t, err, errFallbackMissing)
+}
+
+var formatVerb = regexp.MustCompile(`%(\[\d+\])?[a-z]`)
+
+// Test_Locales_CoverErrorCatalog checks the built-in locales: English documents every cataloged error,
+// and translations take the same number of arguments.
+func Test_Locales_CoverErrorCatalog(t *testing.T) {
+	bundle := CurrentBundle()
+	english := bundle.catalogs[Fallback]
+
+	for _, definition := range common.ErrorDefinitions("") {
+		if _, ok := english.Messages[definition.Identifier]; !ok {
+			t.Errorf("en.yml has no message for %s", definition.Identifier)
+		}
+		if _, ok := english.Titles[definition.Type]; !ok {
+			t.Errorf("en.yml has no title for %s", definition.Type)
+		}
+	}
+
+	for tag, catalog := range bundle.catalogs {
+		for identifier, message := range catalog.Messages {
+			expected := len(formatVerb.FindAllString(english.Messages[identifier], -1))
+			if actual := len(formatVerb.FindAllString(message, -1)); actual != expected {
+				t.Errorf("%s message of %s has %d arguments, %d expected", tag, identifier, actual, expected)
+			}
+		}
+		for rule, message := range catalog.Rules {
+			expected := len(formatVerb.FindAllString(english.Rules[rule], -1))
+			if actual := len(formatVerb.FindAllString(message, -1)); actual != expected {
+				t.Errorf("%s message of rule %s has %d arguments, %d expected", tag, rule, actual, expected)
+			}
+		}
+	}
+}
+
+func Test_Bundle_Rule_FormatsParam(t *testing.T) {
+	bundle := CurrentBundle()
+
+	message, ok := bundle.Rule(language.Portuguese, "max", "100")
+	assert.True(t, ok)
+	assert.Equal(t, "deve ter no máximo 100 caracteres", message)
+
+	message, ok = bundle.Rule(language.Spanish, "required", "")
+	assert.True(t, ok)
+	assert.Equal(t, "es obligatorio", message)
+}
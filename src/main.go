@@ -3,35 +3,92 @@ package main
 import (
 	"backend-sample/apis"
 	"backend-sample/common"
+	"backend-sample/config"
 	"backend-sample/database"
+	"backend-sample/health"
+	"backend-sample/i18n"
+	"backend-sample/metrics"
 	"backend-sample/middlewares"
-	"errors"
-	"fmt"
+	"backend-sample/tracing"
+	"context"
+	"flag"
+	"io"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
 )
 
-var (
-	errInvalidConfigFile = errors.New("invalid configuration file")
-)
-
-var mysqldb database.MySqlDatabaseService
+var mysqldb *database.MySqlDatabaseService
 
 func main() {
-	readDbConfig()
-	apis.Initialize(mysqldb)
+	if runCommand(os.Args[1:]) {
+		return
+	}
 
-	key, err := common.GenerateAESKey(32)
+	options := config.RegisterFlags(flag.CommandLine)
+	flag.Usage = usage
+	flag.Parse()
 
+	configuration, err := config.Load(*options)
 	if err != nil {
-		log.Fatalf("Could not generate AES")
+		log.Fatalf("Error loading configuration:\n%v", err)
 	}
 
-	fmt.Println(fmt.Sprintf("AES key: %s", common.EncodeBase64(key)))
+	setupLogger(configuration.Logging)
+	shutdownTracing := setupTracing(configuration.Tracing)
+	defer shutdownTracing(context.Background())
+
+	var berr *common.BackendError
+	mysqldb, berr = database.NewMySqlDatabaseService(configuration.Database)
+	if berr != nil {
+		log.Fatalf("Error creating database service, %s", berr)
+	}
+	waitForDatabase(configuration.Database.StartupTimeout)
+
+	setEncryption(configuration.Encryption)
+	setErrorCodeKeyring(configuration.ErrorCodes)
+	setLocalization(configuration.Localization)
+	middlewares.SetAdminToken(configuration.Admin.Token)
+	middlewares.SetConcurrencyLimit(configuration.LoadShedding)
+	middlewares.SetRequestTimeouts(configuration.Timeouts)
+	fieldEncryptor, err := database.NewFieldEncryptor(configuration.FieldEncryption)
+	if err != nil {
+		log.Fatalf("Error creating field encryptor, %s", err)
+	}
+	userCache, err := database.NewUserCache(configuration.Cache, fieldEncryptor)
+	if err != nil {
+		log.Fatalf("Error creating user cache, %s", err)
+	}
+	if userCache != nil {
+		defer userCache.Close()
+	}
+	apis.Initialize(mysqldb, fieldEncryptor, userCache, configuration.Cache)
+	reencryptor := database.NewReencryptor(mysqldb, fieldEncryptor)
+	apis.InitializeReencryption(reencryptor)
 
-	router := gin.Default()
+	reloader := &configurationReloader{current: configuration, fieldEncryptor: fieldEncryptor}
+	config.Watch(*options, reloader.apply)
+
+	healthRegistry := health.NewRegistry(configuration.Health.Timeout)
+	healthRegistry.Register("database", health.CheckerFunc(mysqldb.Ping))
+	apis.InitializeHealth(healthRegistry)
+
+	if err := metrics.RegisterDBStats(mysqldb.Configuration.Database, mysqldb.Stats); err != nil {
+		slog.Error("failed to register database metrics", "error", err)
+	}
+
+	router := gin.New()
+	router.Use(middlewares.RequestIdHandler)
+	router.Use(middlewares.CallerHandler)
+	router.Use(middlewares.TracingHandler)
+	router.Use(middlewares.LoggingHandler)
+	router.Use(middlewares.MetricsHandler)
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, middlewares.RecoveryHandler))
 	router.Use(middlewares.MiddlewareHandler)
 
 	router.GET("/ping", func(c *gin.Context) {
@@ -40,56 +97,99 @@ func main() {
 		})
 	})
 
-	router.GET("/users", apis.GetUser)
-	router.POST("/users", apis.AddUser)
-	router.DELETE("/users/:userId", apis.DeleteUser)
-	router.PUT("/users/:userId", apis.UpdateUser)
+	router.GET("/healthz", apis.Liveness)
+	router.GET("/readyz", apis.Readiness)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	router.GET("/problems", apis.GetProblems)
+	router.GET("/problems/:type", apis.GetProblem)
+
+	users := router.Group("/users", middlewares.ConcurrencyLimitHandler, middlewares.TimeoutHandler, middlewares.UserLoaderHandler)
+	users.GET("", apis.GetUser)
+	users.POST("", apis.AddUser)
+	users.DELETE("/:userId", apis.DeleteUser)
+	users.PUT("/:userId", apis.UpdateUser)
+
+	admin := router.Group("/admin", middlewares.AdminHandler)
+	admin.POST("/error-codes/decode", apis.DecodeErrorCode)
+	admin.POST("/reencryption", apis.StartReencryption)
+	admin.GET("/reencryption", apis.GetReencryption)
+	admin.GET("/users/export", apis.ExportUsers)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go mysqldb.MonitorReplicas(ctx)
+
+	serverConfig := configuration.Server
+	if err := runServer(ctx, newHttpServer(serverConfig, router), serverConfig.ShutdownTimeout); err != nil {
+		slog.Error("server stopped with error", "error", err)
+	}
+
+	reencryptor.Stop()
 
-	if err := router.Run(); err != nil {
-		log.Fatalf("Failed to run server: %v", err)
+	if err := mysqldb.Close(); err != nil {
+		slog.Error("failed to close database", "error", err)
 	}
 
+	slog.Info("server stopped")
 }
 
-func readDbConfig() {
-	viper.SetConfigName("db")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("../configs")
+// waitForDatabase blocks until the database answers, exiting after timeout. A zero timeout does not wait.
+func waitForDatabase(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
 
-	// Read the configuration file
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("Error reading config file: %v", err)
-		panic(errInvalidConfigFile)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := mysqldb.WaitUntilReady(ctx); err != nil {
+		log.Fatalf("Error waiting for the database, %s", err)
 	}
+}
 
-	// err := yaml.Unmarshal([]byte(dbConfig), &config)
+func setEncryption(config common.EncryptionConfiguration) {
+	if err := common.ConfigureEncryption(config); err != nil {
+		log.Fatalf("Error configuring encryption, %s", err)
+	}
+	if config.AllowLegacyCFB {
+		slog.Warn("legacy CFB ciphertexts are still accepted, disable encryption.allowLegacyCFB once they are re-encrypted")
+	}
+}
 
-	// if err != nil {
-	// 	log.Fatal(err)
-	// 	panic(errCouldNotParseConfigFile)
-	// }
+func setLocalization(config i18n.LocalizationConfiguration) {
+	bundle, err := i18n.Load(config)
+	if err != nil {
+		slog.Error("failed to load localized messages", "error", err)
+		return
+	}
 
-	mysqldb.Configuration = database.DatabaseConfiguration{
-		Host:         viper.GetString("database.Host"),
-		Database:     viper.GetString("database.Database"),
-		User:         viper.GetString("database.User"),
-		Password:     viper.GetString("database.Password"),
-		Port:         viper.GetInt("database.Port"),
-		MaxLifetime:  viper.GetInt("database.MaxLifetime"),
-		MaxOpenConns: viper.GetInt("database.MaxOpenConns"),
-		MaxIdleConns: viper.GetInt("database.MaxIdleConns"),
+	i18n.SetBundle(bundle)
+}
+
+func setErrorCodeKeyring(config common.KeyringConfiguration) {
+	keyring, err := common.NewErrorCodeKeyring(config)
+	if err != nil {
+		log.Fatalf("Error creating error code keyring, %s", err)
 	}
 
-	var keys []middlewares.KeyValue
-	err := viper.UnmarshalKey("keys", &keys)
+	common.SetErrorCodeKeyring(keyring)
+}
+
+func setupLogger(config common.LoggingConfiguration) {
+	logger, err := common.NewLogger(config, os.Stdout)
 	if err != nil {
-		log.Fatalf("Error unmarshaling 'keys', %s", err)
+		log.Fatalf("Error creating logger, %s", err)
 	}
 
-	// Print out the values
-	for _, key := range keys {
-		if key.Key == "error_code" {
-			middlewares.ErrorCodeKey = middlewares.KeyValue{Key: key.Key, Value: key.Value}
-		}
+	slog.SetDefault(logger)
+}
+
+func setupTracing(config tracing.TracingConfiguration) func(context.Context) error {
+	shutdown, err := tracing.Setup(context.Background(), config)
+	if err != nil {
+		log.Fatalf("Error setting up tracing, %s", err)
 	}
+
+	return shutdown
 }
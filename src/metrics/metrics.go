@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every collector exposed by Handler.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HttpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HttpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	BackendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_errors_total",
+		Help: "Number of BackendErrors returned to clients by identifier and HTTP code.",
+	}, []string{"identifier", "code"})
+
+	WorkflowDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "workflow_duration_seconds",
+		Help:    "Duration of workflow operations.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	RepositoryQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "repository_query_duration_seconds",
+		Help:    "Duration of repository queries by method.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	RepositoryRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "repository_retries_total",
+		Help: "Number of retried repository queries by method and outcome: retried, recovered or exhausted.",
+	}, []string{"method", "outcome"})
+
+	RepositoryCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "repository_cache_requests_total",
+		Help: "Number of user cache requests by result: hit, negative_hit, miss or error.",
+	}, []string{"result"})
+
+	DatabaseCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "database_circuit_state",
+		Help: "State of the circuit breaker of a database pool, the primary or a replica: 0 closed, 1 open, 2 half-open.",
+	}, []string{"pool"})
+
+	DatabaseReplicaHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "database_replica_healthy",
+		Help: "Whether a database replica answered its last health check and receives reads.",
+	}, []string{"replica"})
+
+	DatabaseReplicaLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "database_replica_latency_seconds",
+		Help: "Moving average of the health check latency of a database replica.",
+	}, []string{"replica"})
+
+	HttpConcurrencyLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_concurrency_limit",
+		Help: "Current adaptive limit of concurrent requests before load is shed.",
+	})
+
+	HttpRequestsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_shed_total",
+		Help: "Number of HTTP requests rejected by the concurrency limiter by method and route.",
+	}, []string{"method", "route"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HttpRequests,
+		HttpRequestDuration,
+		BackendErrors,
+		WorkflowDuration,
+		RepositoryQueryDuration,
+		RepositoryRetries,
+		RepositoryCacheRequests,
+		DatabaseCircuitState,
+		DatabaseReplicaHealthy,
+		DatabaseReplicaLatency,
+		HttpConcurrencyLimit,
+		HttpRequestsShed,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveDuration starts a timer and returns the function that records it, meant to be deferred:
+//
+//	defer metrics.ObserveDuration(metrics.RepositoryQueryDuration, "GetUsers")()
+func ObserveDuration(histogram *prometheus.HistogramVec, label string) func() {
+	start := time.Now()
+	return func() {
+		histogram.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	}
+}
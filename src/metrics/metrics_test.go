@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Handler_ExposesMetrics(t *testing.T) {
+	// Registry is shared by the whole package, the test leaves it as it found it so it can run again.
+	dbStats := newDBStatsCollector("users", func() sql.DBStats {
+		return sql.DBStats{MaxOpenConnections: 5, OpenConnections: 3, InUse: 2, Idle: 1, WaitCount: 4, WaitDuration: 2 * time.Second}
+	})
+	assert.NoError(t, Registry.Register(dbStats))
+	t.Cleanup(func() {
+		Registry.Unregister(dbStats)
+		BackendErrors.DeleteLabelValues("GetUserById.3", "404")
+		RepositoryQueryDuration.DeleteLabelValues("GetUserById")
+	})
+
+	BackendErrors.WithLabelValues("GetUserById.3", "404").Inc()
+	ObserveDuration(RepositoryQueryDuration, "GetUserById")()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, body, `go_sql_in_use_connections{db_name="users"} 2`)
+	assert.Contains(t, body, `go_sql_wait_duration_seconds_total{db_name="users"} 2`)
+	assert.Contains(t, body, `backend_errors_total{code="404",identifier="GetUserById.3"} 1`)
+	assert.Contains(t, body, `repository_query_duration_seconds_count{method="GetUserById"} 1`)
+}
@@ -0,0 +1,36 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+var adminToken atomic.Value
+
+// SetAdminToken sets the bearer token accepted by AdminHandler. An empty token disables admin endpoints.
+func SetAdminToken(token string) {
+	adminToken.Store(token)
+}
+
+// AdminHandler only lets through requests carrying the admin bearer token.
+func AdminHandler(c *gin.Context) {
+	token, _ := adminToken.Load().(string)
+	if token == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		slog.WarnContext(c.Request.Context(), "admin request rejected", "path", c.Request.URL.Path, "client_ip", c.ClientIP())
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	c.Next()
+}
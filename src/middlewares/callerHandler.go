@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"backend-sample/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIdHeader identifies a client across requests, e.g. one per browser session or service instance.
+const ClientIdHeader = "X-Client-ID"
+
+// CallerHandler tags the request context with its caller, the X-Client-ID sent by the client or
+// its IP address, so the caller reads its own writes even when reads go to replicas.
+func CallerHandler(c *gin.Context) {
+	caller := c.GetHeader(ClientIdHeader)
+	if !isValidRequestId(caller) {
+		caller = c.ClientIP()
+	}
+
+	c.Request = c.Request.WithContext(database.WithCaller(c.Request.Context(), caller))
+
+	c.Next()
+}
@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"backend-sample/common"
+	"backend-sample/metrics"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ConcurrencyLimitConfiguration struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// InitialLimit, MinLimit and MaxLimit bound the number of requests handled at once.
+	InitialLimit int `json:"initialLimit" yaml:"initialLimit"`
+	MinLimit     int `json:"minLimit" yaml:"minLimit"`
+	MaxLimit     int `json:"maxLimit" yaml:"maxLimit"`
+	// LatencyTarget is the latency above which requests are considered a sign of overload.
+	LatencyTarget time.Duration `json:"latencyTarget" yaml:"latencyTarget"`
+}
+
+const (
+	// limitDecrease is the factor applied to the limit when a request shows overload.
+	limitDecrease = 0.9
+	// shedRetryAfter is the Retry-After of shed requests.
+	shedRetryAfter = time.Second
+)
+
+// concurrencyLimiter adapts its limit with additive increase and multiplicative decrease: the limit
+// grows by one per limit's worth of fast requests while it is used, and shrinks by 10% whenever a
+// request is slow or the database is unavailable, so excess load is shed before it reaches the workflows.
+type concurrencyLimiter struct {
+	mu       sync.Mutex
+	config   ConcurrencyLimitConfiguration
+	limit    float64
+	inFlight int
+}
+
+var limiter concurrencyLimiter
+
+// SetConcurrencyLimit configures ConcurrencyLimitHandler, restarting from the initial limit when it changes.
+func SetConcurrencyLimit(config ConcurrencyLimitConfiguration) {
+	limiter.configure(config)
+}
+
+func (l *concurrencyLimiter) configure(config ConcurrencyLimitConfiguration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.InitialLimit != config.InitialLimit || l.limit == 0 {
+		l.limit = float64(config.InitialLimit)
+	}
+	l.config = config
+	l.limit = math.Min(math.Max(l.limit, float64(config.MinLimit)), float64(config.MaxLimit))
+	metrics.HttpConcurrencyLimit.Set(l.limit)
+}
+
+// acquire reserves a slot for a request, reporting false when the limit is reached.
+func (l *concurrencyLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.Enabled && l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// release frees the slot of a request and adapts the limit to how it went.
+func (l *concurrencyLimiter) release(latency time.Duration, overloaded bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	if !l.config.Enabled {
+		return
+	}
+
+	switch {
+	case overloaded || latency > l.config.LatencyTarget:
+		l.limit = math.Max(l.limit*limitDecrease, float64(l.config.MinLimit))
+	case float64(l.inFlight+1) >= l.limit/2:
+		// Growing an idle limit would only let a later burst through at once.
+		l.limit = math.Min(l.limit+1/l.limit, float64(l.config.MaxLimit))
+	}
+	metrics.HttpConcurrencyLimit.Set(l.limit)
+}
+
+// ConcurrencyLimitHandler rejects requests with 503 and Retry-After once the adaptive limit of
+// concurrent requests is reached. It must run after MiddlewareHandler, which renders the rejection.
+func ConcurrencyLimitHandler(c *gin.Context) {
+	if !limiter.acquire() {
+		metrics.HttpRequestsShed.WithLabelValues(c.Request.Method, c.FullPath()).Inc()
+		c.Error(common.NewBackendError(503, "Middlewares.ConcurrencyLimit.1", "server is overloaded, try again later", nil).WithRetryAfter(shedRetryAfter))
+		c.Abort()
+		return
+	}
+
+	start := time.Now()
+	// Deferred so a panicking handler still frees its slot.
+	defer func() { limiter.release(time.Since(start), isOverloaded(c)) }()
+	c.Next()
+}
+
+// isOverloaded reports whether the request failed because a dependency could not keep up.
+func isOverloaded(c *gin.Context) bool {
+	err := c.Errors.Last()
+	if err == nil {
+		return false
+	}
+	berr, ok := err.Err.(*common.BackendError)
+	return ok && (berr.Code == http.StatusServiceUnavailable || berr.Code == http.StatusGatewayTimeout)
+}
@@ -0,0 +1,76 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var testConcurrencyLimit = ConcurrencyLimitConfiguration{
+	Enabled:       true,
+	InitialLimit:  2,
+	MinLimit:      1,
+	MaxLimit:      4,
+	LatencyTarget: 100 * time.Millisecond,
+}
+
+func Test_ConcurrencyLimiter_LimitReached_ExpectRejected(t *testing.T) {
+	var l concurrencyLimiter
+	l.configure(testConcurrencyLimit)
+
+	assert.True(t, l.acquire())
+	assert.True(t, l.acquire())
+	assert.False(t, l.acquire())
+
+	l.release(time.Millisecond, false)
+	assert.True(t, l.acquire())
+}
+
+func Test_ConcurrencyLimiter_Adapts_ExpectBoundedLimit(t *testing.T) {
+	var l concurrencyLimiter
+	l.configure(testConcurrencyLimit)
+
+	for i := 0; i < 50; i++ {
+		l.acquire()
+		l.release(time.Second, false)
+	}
+	assert.Equal(t, 1.0, l.limit)
+
+	// The limit only grows while it is used.
+	l = concurrencyLimiter{}
+	l.configure(testConcurrencyLimit)
+	l.acquire()
+	for i := 0; i < 50; i++ {
+		l.acquire()
+		l.release(time.Millisecond, false)
+	}
+	assert.Equal(t, 4.0, l.limit)
+
+	l.acquire()
+	l.release(time.Millisecond, true)
+	assert.InDelta(t, 3.6, l.limit, 1e-9)
+}
+
+func Test_ConcurrencyLimitHandler_Overloaded_Expect503WithRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetConcurrencyLimit(ConcurrencyLimitConfiguration{Enabled: true, InitialLimit: 1, MinLimit: 1, MaxLimit: 1, LatencyTarget: time.Second})
+	defer SetConcurrencyLimit(ConcurrencyLimitConfiguration{})
+
+	assert.True(t, limiter.acquire())
+	defer limiter.release(0, false)
+
+	router := gin.New()
+	router.Use(MiddlewareHandler)
+	router.GET("/users", ConcurrencyLimitHandler, func(c *gin.Context) { c.Set("response", "ok") })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "/problems/server-overloaded")
+}
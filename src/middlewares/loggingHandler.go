@@ -0,0 +1,39 @@
+package middlewares
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoggingHandler writes one access log line per request.
+func LoggingHandler(c *gin.Context) {
+	start := time.Now()
+
+	c.Next()
+
+	status := c.Writer.Status()
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	} else if status >= http.StatusBadRequest {
+		level = slog.LevelWarn
+	}
+
+	slog.Log(c.Request.Context(), level, "request completed",
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"route", c.FullPath(),
+		"status", status,
+		"latency", time.Since(start),
+		"client_ip", c.ClientIP(),
+	)
+}
+
+// RecoveryHandler logs a recovered panic and answers with 500.
+func RecoveryHandler(c *gin.Context, recovered any) {
+	slog.ErrorContext(c.Request.Context(), "panic recovered", "error", recovered)
+	c.AbortWithStatus(http.StatusInternalServerError)
+}
@@ -2,23 +2,44 @@ package middlewares
 
 import (
 	"backend-sample/common"
+	"backend-sample/i18n"
+	"backend-sample/metrics"
+	"backend-sample/tracing"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/language"
 	"gopkg.in/yaml.v3"
 )
 
-type KeyValue struct {
-	Key   string `yaml:"key"`
-	Value string `yaml:"value"`
+// ProblemDetails is an RFC 7807 error response, extended with the encrypted error code and the request id.
+type ProblemDetails struct {
+	Type      string `json:"type" yaml:"type"`
+	Title     string `json:"title" yaml:"title"`
+	Status    int    `json:"status" yaml:"status"`
+	Detail    string `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty" yaml:"instance,omitempty"`
+	ErrorCode string `json:"error_code,omitempty" yaml:"error_code,omitempty"`
+	RequestId string `json:"request_id,omitempty" yaml:"request_id,omitempty"`
+	// Violations lists every invalid field when the request failed validation.
+	Violations []common.Violation `json:"violations,omitempty" yaml:"violations,omitempty"`
 }
 
-var ErrorCodeKey KeyValue
+const (
+	defaultErrorMessage = "An error occurred"
 
-type ErrorResponse struct {
-	ErrorCode string `json,yaml:"error_code"`
-	Message   string `json,yaml:"message"`
-}
+	// untypedProblem is the RFC 7807 type of problems without more semantics than their status.
+	untypedProblem = "about:blank"
+
+	problemJsonContentType = "application/problem+json"
+	problemYamlContentType = "application/problem+yaml"
+)
 
 func MiddlewareHandler(c *gin.Context) {
 
@@ -43,32 +64,117 @@ func handleError(c *gin.Context) {
 	err := c.Errors.Last()
 
 	if err != nil {
-		errCode := 500
-		var errResponse ErrorResponse
+		ctx := c.Request.Context()
+		bundle := i18n.CurrentBundle()
+		tag := bundle.Match(c.GetHeader("Accept-Language"))
+		problem := ProblemDetails{
+			Type:      untypedProblem,
+			Status:    http.StatusInternalServerError,
+			Instance:  c.Request.URL.Path,
+			RequestId: common.RequestIdFromContext(ctx),
+		}
 		if berr, ok := err.Err.(*common.BackendError); ok {
-			if errorCode, err := common.EncryptAES([]byte(ErrorCodeKey.Key), berr.Identifier); err != nil {
-				errResponse = ErrorResponse{
-					Message: "Error generating error code",
+			berr.RequestId = problem.RequestId
+			problem.Status = berr.Code
+			problem.Detail = berr.Message
+			if message, ok := bundle.Message(tag, berr.Identifier, berr.Args...); ok {
+				problem.Detail = message
+			}
+			if problem.Detail == "" {
+				problem.Detail = defaultErrorMessage
+			}
+			problem.Violations = localizeViolations(bundle, tag, berr.Violations)
+			if berr.RetryAfter > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(berr.RetryAfter.Seconds()))))
+			}
+			if definition, ok := common.LookupError(berr.Identifier); ok {
+				problem.Type, problem.Title = definition.Type, definition.Title
+				if title, ok := bundle.Title(tag, definition.Type); ok {
+					problem.Title = title
 				}
 			} else {
-				errCode = berr.Code
-				errResponse = ErrorResponse{
-					ErrorCode: errorCode,
-					Message:   berr.Message,
-				}
+				slog.WarnContext(ctx, "error identifier is not in the catalog", "identifier", berr.Identifier)
 			}
-		} else {
-			errResponse = ErrorResponse{
-				Message: err.Error(),
+			if errorCode, err := encodeErrorCode(berr); err != nil {
+				slog.ErrorContext(ctx, "could not generate error code", "identifier", berr.Identifier, "error", err)
+			} else {
+				problem.ErrorCode = errorCode
 			}
+			logBackendError(ctx, berr)
+			metrics.BackendErrors.WithLabelValues(berr.Identifier, strconv.Itoa(berr.Code)).Inc()
+			tracing.RecordBackendError(trace.SpanFromContext(ctx), berr)
+		} else {
+			problem.Detail = err.Error()
+			slog.ErrorContext(ctx, "request failed", "error", err.Err)
+		}
+		if problem.Title == "" {
+			problem.Title = http.StatusText(problem.Status)
 		}
+		c.Header("Content-Language", tag.String())
 
-		formatHttpResponse(errCode, errResponse, c)
+		formatProblemResponse(problem, c)
 
 		c.Abort()
 	}
 }
 
+func localizeViolations(bundle *i18n.Bundle, tag language.Tag, violations []common.Violation) []common.Violation {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	localized := make([]common.Violation, len(violations))
+	for i, violation := range violations {
+		if message, ok := bundle.Rule(tag, violation.Rule, violation.Param); ok {
+			violation.Message = message
+		}
+		localized[i] = violation
+	}
+	return localized
+}
+
+func encodeErrorCode(berr *common.BackendError) (string, error) {
+	keyring, err := common.CurrentErrorCodeKeyring()
+	if err != nil {
+		return "", err
+	}
+
+	return keyring.Encode(common.NewErrorCodePayload(berr.Identifier, berr.RequestId))
+}
+
+func logBackendError(ctx context.Context, berr *common.BackendError) {
+	level := slog.LevelWarn
+	if berr.Code >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+
+	slog.Log(ctx, level, "request failed",
+		"identifier", berr.Identifier,
+		"code", berr.Code,
+		"message", berr.Message,
+		"error", berr.Err,
+	)
+}
+
+func formatProblemResponse(problem ProblemDetails, c *gin.Context) {
+	switch c.GetHeader("Accept") {
+	case "application/x-yaml", problemYamlContentType:
+		yamlData, err := yaml.Marshal(problem)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate YAML response"})
+			return
+		}
+		c.Data(problem.Status, problemYamlContentType, yamlData)
+	default:
+		jsonData, err := json.Marshal(problem)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate JSON response"})
+			return
+		}
+		c.Data(problem.Status, problemJsonContentType, jsonData)
+	}
+}
+
 func formatHttpResponse(statusCode int, response interface{}, c *gin.Context) {
 	switch c.GetHeader("Accept") {
 	case "application/x-yaml":
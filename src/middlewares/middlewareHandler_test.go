@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"backend-sample/common"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -16,6 +17,7 @@ func TestMiddlewareHandler(t *testing.T) {
 	t.Run("Test formatRespose JSON", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/", nil)
 
 		response := gin.H{"message": "success"}
 		c.Set("response", response)
@@ -46,8 +48,14 @@ func TestMiddlewareHandler(t *testing.T) {
 	t.Run("Test handleError with BackendError", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/", nil)
 
-		ErrorCodeKey = KeyValue{Key: "testkey", Value: "testvalue"}
+		keyring, err := common.NewErrorCodeKeyring(common.KeyringConfiguration{
+			ActiveKey: "v1",
+			Keys:      []common.KeyConfiguration{{Id: "v1", Value: "LefWEePuYpZb+lVpb+3XwJDj/uuyluNWeE8RI08fiCM="}},
+		})
+		assert.NoError(t, err)
+		common.SetErrorCodeKeyring(keyring)
 		backendError := &common.BackendError{
 			Code:       http.StatusBadRequest,
 			Identifier: "test_identifier",
@@ -59,11 +67,95 @@ func TestMiddlewareHandler(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 		assert.Contains(t, w.Body.String(), "error_code")
 		assert.Contains(t, w.Body.String(), "An error occurred")
+
+		var response ProblemDetails
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		payload, err := keyring.Decode(response.ErrorCode)
+		assert.NoError(t, err)
+		assert.Equal(t, "test_identifier", payload.Identifier)
+		assert.Equal(t, "v1", payload.KeyId)
+	})
+
+	t.Run("Test handleError with cataloged BackendError", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/users", nil)
+
+		c.Error(common.NewBackendError(http.StatusNotFound, "GetUserById.3", "user not found for id %s", nil, "42"))
+
+		handleError(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		var response ProblemDetails
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "/problems/user-not-found", response.Type)
+		assert.Equal(t, "User not found", response.Title)
+		assert.Equal(t, http.StatusNotFound, response.Status)
+		assert.Equal(t, "user not found for id 42", response.Detail)
+		assert.Equal(t, "/users", response.Instance)
+	})
+
+	t.Run("Test handleError localized", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/users", nil)
+		c.Request.Header.Set("Accept-Language", "pt-BR,pt;q=0.9")
+
+		c.Error(common.NewBackendError(http.StatusNotFound, "GetUserById.3", "user not found for id %s", nil, "42"))
+
+		handleError(c)
+
+		var response ProblemDetails
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "pt", w.Header().Get("Content-Language"))
+		assert.Equal(t, "Usuário não encontrado", response.Title)
+		assert.Equal(t, "usuário não encontrado para o id 42", response.Detail)
+	})
+
+	t.Run("Test handleError YAML", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/users", nil)
+		c.Request.Header.Set("Accept", "application/x-yaml")
+
+		c.Error(common.NewBackendError(http.StatusBadRequest, "Workflows.StreamUsers.1", "invalid name", nil))
+
+		handleError(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "application/problem+yaml", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "type: /problems/invalid-name")
+		assert.Contains(t, w.Body.String(), "detail: invalid name")
+	})
+
+	t.Run("Test handleError with violations", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/users", nil)
+		c.Request.Header.Set("Accept-Language", "es")
+
+		c.Error(common.NewBackendError(http.StatusUnprocessableEntity, "Workflows.CreateUser.5", "invalid user", nil).WithViolations([]common.Violation{
+			{Field: "name", Rule: "required", Message: "is required"},
+			{Field: "email", Rule: "max", Param: "100", Message: "must have at most 100 characters"},
+		}))
+
+		handleError(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		var response ProblemDetails
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "/problems/validation-failed", response.Type)
+		assert.Equal(t, []common.Violation{
+			{Field: "name", Rule: "required", Message: "es obligatorio"},
+			{Field: "email", Rule: "max", Message: "debe tener como máximo 100 caracteres"},
+		}, response.Violations)
 	})
 
 	t.Run("Test handleError with generic error", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/", nil)
 
 		c.Error(assert.AnError)
 
@@ -71,5 +163,6 @@ func TestMiddlewareHandler(t *testing.T) {
 
 		assert.Equal(t, http.StatusInternalServerError, w.Code)
 		assert.Contains(t, w.Body.String(), assert.AnError.Error())
+		assert.Contains(t, w.Body.String(), `"type":"about:blank"`)
 	})
 }
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"backend-sample/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+const maxRequestIdLength = 128
+
+// RequestIdHandler reuses the X-Request-ID sent by the client or assigns a new one,
+// stores it in the request context and echoes it in the response.
+func RequestIdHandler(c *gin.Context) {
+	requestId := c.GetHeader(RequestIdHeader)
+	if !isValidRequestId(requestId) {
+		requestId = uuid.NewString()
+	}
+
+	c.Request = c.Request.WithContext(common.WithRequestId(c.Request.Context(), requestId))
+	c.Header(RequestIdHeader, requestId)
+
+	c.Next()
+}
+
+// isValidRequestId only accepts printable ASCII so client values cannot forge log lines.
+func isValidRequestId(requestId string) bool {
+	if len(requestId) == 0 || len(requestId) > maxRequestIdLength {
+		return false
+	}
+
+	for _, r := range requestId {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"backend-sample/common"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIdHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(requestId *string) *gin.Engine {
+		router := gin.New()
+		router.Use(RequestIdHandler, MiddlewareHandler)
+		router.GET("/", func(c *gin.Context) {
+			*requestId = common.RequestIdFromContext(c.Request.Context())
+			c.Error(common.NewBackendError(http.StatusBadRequest, "test_identifier", "bad request", nil))
+		})
+		return router
+	}
+
+	t.Run("Test propagates X-Request-ID", func(t *testing.T) {
+		var requestId string
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIdHeader, "abc-123")
+
+		newRouter(&requestId).ServeHTTP(w, req)
+
+		assert.Equal(t, "abc-123", requestId)
+		assert.Equal(t, "abc-123", w.Header().Get(RequestIdHeader))
+		assert.Contains(t, w.Body.String(), `"request_id":"abc-123"`)
+	})
+
+	t.Run("Test assigns X-Request-ID", func(t *testing.T) {
+		var requestId string
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIdHeader, "bad\nvalue")
+
+		newRouter(&requestId).ServeHTTP(w, req)
+
+		assert.True(t, common.IsValidUuid(requestId))
+		assert.Equal(t, requestId, w.Header().Get(RequestIdHeader))
+	})
+}
@@ -0,0 +1,130 @@
+package middlewares
+
+import (
+	"backend-sample/common"
+	"backend-sample/metrics"
+	"encoding/json"
+	"iter"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// StreamErrorTrailer carries the identifier of the error that interrupted a streamed response,
+	// whose status was sent before the error happened.
+	StreamErrorTrailer = "X-Stream-Error"
+
+	ndjsonContentType = "application/x-ndjson"
+
+	// streamBufferSize is the number of items read before the status is sent, so the errors of
+	// small results are still rendered as problem details.
+	streamBufferSize = 100
+)
+
+// StreamResponse writes items one by one, as a JSON array by default, a YAML sequence or
+// newline-delimited JSON, so the response never needs the whole list in memory.
+//
+// The first streamBufferSize items are read before anything is written: an error among them is
+// rendered by MiddlewareHandler like any other. A later error comes after the 200 status and the
+// first items were sent. The body then ends early, leaving a JSON array without its closing
+// bracket, the error is logged and its identifier is sent in the StreamErrorTrailer trailer.
+func StreamResponse[T any](c *gin.Context, items iter.Seq2[T, error]) {
+	next, stop := iter.Pull2(items)
+	defer stop()
+
+	buffered := make([]T, 0, streamBufferSize)
+	item, err, ok := next()
+	for ok && err == nil && len(buffered) < streamBufferSize {
+		buffered = append(buffered, item)
+		item, err, ok = next()
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	format := c.GetHeader("Accept")
+	var separator, end string
+	switch format {
+	case "application/x-yaml":
+		c.Header("Content-Type", "application/x-yaml")
+	case ndjsonContentType:
+		c.Header("Content-Type", ndjsonContentType)
+	default:
+		c.Header("Content-Type", "application/json")
+		separator, end = ",", "]"
+		format = "application/json"
+	}
+	c.Header("Trailer", StreamErrorTrailer)
+	c.Status(http.StatusOK)
+	if format == "application/json" {
+		c.Writer.WriteString("[")
+	}
+
+	count := 0
+	write := func(item T) bool {
+		if count > 0 {
+			c.Writer.WriteString(separator)
+		}
+		count++
+		if err := writeStreamItem(c, format, item); err != nil {
+			slog.WarnContext(c.Request.Context(), "streamed response interrupted by the client", "error", err)
+			return false
+		}
+		return true
+	}
+
+	for _, item := range buffered {
+		if !write(item) {
+			return
+		}
+	}
+	for ok {
+		if !write(item) {
+			return
+		}
+		item, err, ok = next()
+		if err != nil {
+			failStream(c, err)
+			return
+		}
+	}
+	c.Writer.WriteString(end)
+}
+
+func writeStreamItem[T any](c *gin.Context, format string, item T) error {
+	var data []byte
+	var err error
+	switch format {
+	case "application/x-yaml":
+		// A sequence of one item, concatenated they make the sequence of all of them.
+		data, err = yaml.Marshal([]T{item})
+	case ndjsonContentType:
+		data, err = json.Marshal(item)
+		data = append(data, '\n')
+	default:
+		data, err = json.Marshal(item)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.Writer.Write(data)
+	return err
+}
+
+// failStream logs and counts the error as handleError would, then reports it in the trailer.
+func failStream(c *gin.Context, err error) {
+	identifier := "unknown"
+	if berr, ok := err.(*common.BackendError); ok {
+		identifier = berr.Identifier
+		logBackendError(c.Request.Context(), berr)
+		metrics.BackendErrors.WithLabelValues(berr.Identifier, strconv.Itoa(berr.Code)).Inc()
+	} else {
+		slog.ErrorContext(c.Request.Context(), "streamed response failed", "error", err)
+	}
+	c.Writer.Header().Set(StreamErrorTrailer, identifier)
+}
@@ -0,0 +1,104 @@
+package middlewares
+
+import (
+	"backend-sample/common"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+type streamedItem struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+// items yields names, then err when it is not nil.
+func items(err error, names ...string) iter.Seq2[streamedItem, error] {
+	return func(yield func(streamedItem, error) bool) {
+		for _, name := range names {
+			if !yield(streamedItem{Name: name}, nil) {
+				return
+			}
+		}
+		if err != nil {
+			yield(streamedItem{}, err)
+		}
+	}
+}
+
+func serveStream(accept string, stream iter.Seq2[streamedItem, error]) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	router := gin.New()
+	router.Use(MiddlewareHandler)
+	router.GET("/users", func(c *gin.Context) { StreamResponse(c, stream) })
+
+	request := httptest.NewRequest(http.MethodGet, "/users", nil)
+	request.Header.Set("Accept", accept)
+	router.ServeHTTP(w, request)
+	return w
+}
+
+func Test_StreamResponse_ExpectEveryFormat(t *testing.T) {
+	w := serveStream("", items(nil, "John", "Jane"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"name": "John"}, {"name": "Jane"}]`, w.Body.String())
+
+	w = serveStream("", items(nil))
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	w = serveStream(ndjsonContentType, items(nil, "John", "Jane"))
+	assert.Equal(t, "{\"name\":\"John\"}\n{\"name\":\"Jane\"}\n", w.Body.String())
+
+	w = serveStream("application/x-yaml", items(nil, "John", "Jane"))
+	var decoded []streamedItem
+	assert.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &decoded))
+	assert.Equal(t, []streamedItem{{"John"}, {"Jane"}}, decoded)
+}
+
+func Test_StreamResponse_FirstItemFails_ExpectProblem(t *testing.T) {
+	w := serveStream("", items(common.NewBackendError(http.StatusServiceUnavailable, "ClassifyError.5", "database is unavailable", nil)))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, problemJsonContentType, w.Header().Get("Content-Type"))
+}
+
+func Test_StreamResponse_FailsWithinBuffer_ExpectProblem(t *testing.T) {
+	w := serveStream("", items(common.NewBackendError(http.StatusInternalServerError, "GetUsers.4", "could not decrypt email.", nil), "John", "Jane"))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, problemJsonContentType, w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "John")
+}
+
+func Test_StreamResponse_FailsAfterBuffer_ExpectTruncatedBodyAndTrailer(t *testing.T) {
+	names := make([]string, streamBufferSize+1)
+	for i := range names {
+		names[i] = "John"
+	}
+	w := serveStream("", items(common.NewBackendError(http.StatusInternalServerError, "GetUsers.4", "could not decrypt email.", nil), names...))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, `[{"name":"John"},`))
+	assert.True(t, strings.HasSuffix(body, `{"name":"John"}`), "the array is left open")
+	assert.Equal(t, streamBufferSize+1, strings.Count(body, "John"))
+	assert.Equal(t, "GetUsers.4", w.Result().Trailer.Get(StreamErrorTrailer))
+}
+
+func Test_StreamResponse_MoreThanBuffer_ExpectEveryItem(t *testing.T) {
+	names := make([]string, 2*streamBufferSize+1)
+	for i := range names {
+		names[i] = "John"
+	}
+	w := serveStream(ndjsonContentType, items(nil, names...))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, len(names), strings.Count(w.Body.String(), "\n"))
+	assert.Empty(t, w.Result().Trailer.Get(StreamErrorTrailer))
+}
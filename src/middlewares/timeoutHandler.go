@@ -0,0 +1,103 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteTimeout overrides the default timeout of one route. Path is the route pattern, e.g. /users/:userId.
+type RouteTimeout struct {
+	Method  string        `json:"method" yaml:"method"`
+	Path    string        `json:"path" yaml:"path"`
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+}
+
+type TimeoutConfiguration struct {
+	// Default is the deadline of the routes not listed in Routes. Zero leaves them without deadline.
+	Default time.Duration `json:"default" yaml:"default"`
+	// Routes is a list rather than a map, configuration keys are case insensitive and paths are not.
+	Routes []RouteTimeout `json:"routes" yaml:"routes"`
+	// Stream is the deadline of streamed responses, replacing the timeout of their route and the
+	// write timeout of the server. Zero leaves them without deadline.
+	Stream time.Duration `json:"stream" yaml:"stream"`
+}
+
+// requestContextKey holds the request context before TimeoutHandler set its deadline.
+const requestContextKey = "requestContext"
+
+// timeoutFor returns the timeout of the route, zero when it has none.
+func (c TimeoutConfiguration) timeoutFor(method, path string) time.Duration {
+	for _, route := range c.Routes {
+		if strings.EqualFold(route.Method, method) && route.Path == path {
+			return route.Timeout
+		}
+	}
+	return c.Default
+}
+
+var requestTimeouts atomic.Pointer[TimeoutConfiguration]
+
+// SetRequestTimeouts configures the deadlines set by TimeoutHandler.
+func SetRequestTimeouts(config TimeoutConfiguration) {
+	requestTimeouts.Store(&config)
+}
+
+// TimeoutHandler sets the deadline of the route on the request context, so the queries of a slow
+// request are canceled and it fails with 504 instead of holding a connection.
+func TimeoutHandler(c *gin.Context) {
+	config := requestTimeouts.Load()
+	if config == nil {
+		c.Next()
+		return
+	}
+	timeout := config.timeoutFor(c.Request.Method, c.FullPath())
+	if timeout <= 0 {
+		c.Next()
+		return
+	}
+
+	c.Set(requestContextKey, c.Request.Context())
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
+// ExtendForStream gives the request the deadline of streamed responses instead of the one of its
+// route, on its context and on the writes of its response. It is still canceled when the client
+// goes away. Call the returned function once the response is written.
+func ExtendForStream(c *gin.Context) context.CancelFunc {
+	var timeout time.Duration
+	if config := requestTimeouts.Load(); config != nil {
+		timeout = config.Stream
+	}
+
+	parent := c.Request.Context()
+	if requestContext, ok := c.Get(requestContextKey); ok {
+		parent = requestContext.(context.Context)
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+		ctx, cancel = context.WithDeadline(parent, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	c.Request = c.Request.WithContext(ctx)
+
+	// A zero deadline lifts the write timeout of the server for this response only.
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.WarnContext(ctx, "could not extend the write deadline of a streamed response", "error", err)
+	}
+	return cancel
+}
@@ -0,0 +1,113 @@
+package middlewares
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TimeoutHandler_ExpectRouteDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetRequestTimeouts(TimeoutConfiguration{
+		Default: time.Minute,
+		Routes:  []RouteTimeout{{Method: "get", Path: "/users/:userId", Timeout: time.Second}},
+	})
+	defer SetRequestTimeouts(TimeoutConfiguration{})
+
+	remaining := map[string]time.Duration{}
+	router := gin.New()
+	router.Use(TimeoutHandler)
+	handler := func(c *gin.Context) {
+		deadline, ok := c.Request.Context().Deadline()
+		assert.True(t, ok)
+		remaining[c.Request.Method] = time.Until(deadline)
+	}
+	router.GET("/users/:userId", handler)
+	router.DELETE("/users/:userId", handler)
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/users/1", nil))
+	}
+
+	assert.LessOrEqual(t, remaining[http.MethodGet], time.Second)
+	assert.Greater(t, remaining[http.MethodDelete], time.Second)
+}
+
+func Test_TimeoutHandler_NoTimeout_ExpectNoDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetRequestTimeouts(TimeoutConfiguration{})
+
+	router := gin.New()
+	router.Use(TimeoutHandler)
+	router.GET("/users", func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		assert.False(t, ok)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+}
+
+func Test_ExtendForStream_ExpectStreamDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetRequestTimeouts(TimeoutConfiguration{Default: time.Second, Stream: time.Hour})
+	defer SetRequestTimeouts(TimeoutConfiguration{})
+
+	var remaining time.Duration
+	var canceled error
+	router := gin.New()
+	router.Use(TimeoutHandler)
+	router.GET("/users", func(c *gin.Context) {
+		cancel := ExtendForStream(c)
+		deadline, ok := c.Request.Context().Deadline()
+		assert.True(t, ok)
+		remaining = time.Until(deadline)
+		cancel()
+		canceled = c.Request.Context().Err()
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	assert.Greater(t, remaining, time.Minute)
+	assert.ErrorIs(t, canceled, context.Canceled)
+}
+
+func Test_ExtendForStream_SlowerThanWriteTimeout_ExpectWholeBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetRequestTimeouts(TimeoutConfiguration{Default: 50 * time.Millisecond})
+	defer SetRequestTimeouts(TimeoutConfiguration{})
+
+	router := gin.New()
+	router.Use(TimeoutHandler)
+	router.GET("/users", func(c *gin.Context) {
+		defer ExtendForStream(c)()
+		for i := 0; i < 3; i++ {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+			c.Writer.WriteString("item\n")
+			c.Writer.Flush()
+		}
+	})
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/users")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "item\nitem\nitem\n", string(body))
+}
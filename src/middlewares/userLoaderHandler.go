@@ -0,0 +1,15 @@
+package middlewares
+
+import (
+	"backend-sample/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserLoaderHandler gives the request its own user loader, so the users it looks up by id at about
+// the same time are read with one query.
+func UserLoaderHandler(c *gin.Context) {
+	c.Request = c.Request.WithContext(database.WithUserLoader(c.Request.Context()))
+
+	c.Next()
+}
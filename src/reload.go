@@ -0,0 +1,46 @@
+package main
+
+import (
+	"backend-sample/common"
+	"backend-sample/config"
+	"backend-sample/database"
+	"backend-sample/middlewares"
+	"log/slog"
+	"sync"
+)
+
+// configurationReloader applies the runtime settings of reloaded configurations.
+type configurationReloader struct {
+	mu             sync.Mutex
+	current        *config.Configuration
+	fieldEncryptor *database.FieldEncryptor
+}
+
+func (r *configurationReloader) apply(next *config.Configuration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sections := config.RestartRequired(r.current, next); len(sections) > 0 {
+		slog.Warn("configuration changes require a restart", "sections", sections)
+	}
+
+	mysqldb.SetPoolSettings(next.Database.MaxOpenConns, next.Database.MaxIdleConns, next.Database.MaxLifetime)
+	mysqldb.SetRetryPolicy(next.Database.Retry)
+	mysqldb.SetCircuitBreakerPolicy(next.Database.CircuitBreaker)
+	middlewares.SetConcurrencyLimit(next.LoadShedding)
+	middlewares.SetRequestTimeouts(next.Timeouts)
+
+	if level, err := common.ParseLogLevel(next.Logging.Level); err == nil {
+		common.LogLevel.Set(level)
+	}
+
+	setEncryption(next.Encryption)
+	setErrorCodeKeyring(next.ErrorCodes)
+	setLocalization(next.Localization)
+	middlewares.SetAdminToken(next.Admin.Token)
+	if err := r.fieldEncryptor.Update(next.FieldEncryption); err != nil {
+		slog.Error("failed to update field encryption keys", "error", err)
+	}
+
+	r.current = next
+}
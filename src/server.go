@@ -0,0 +1,53 @@
+package main
+
+import (
+	"backend-sample/config"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+func newHttpServer(serverConfig config.ServerConfiguration, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              serverConfig.Address,
+		Handler:           handler,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
+		MaxHeaderBytes:    serverConfig.MaxHeaderBytes,
+	}
+}
+
+// runServer serves until ctx is cancelled, then stops accepting connections and waits
+// up to shutdownTimeout for in-flight requests to finish.
+func runServer(ctx context.Context, server *http.Server, shutdownTimeout time.Duration) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("server listening", "address", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down server", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+		return err
+	}
+
+	if err := <-serverErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
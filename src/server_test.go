@@ -0,0 +1,91 @@
+package main
+
+import (
+	"backend-sample/config"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	return newHttpServer(config.ServerConfiguration{Address: address, ReadHeaderTimeout: time.Second}, handler), address
+}
+
+func Test_RunServer_DrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	server, address := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- runServer(ctx, server, time.Second) }()
+
+	response := make(chan string, 1)
+	go func() {
+		var res *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if res, err = http.Get("http://" + address); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		response <- string(body)
+	}()
+
+	<-started
+	cancel()
+
+	assert.Equal(t, "done", <-response)
+	assert.NoError(t, <-result)
+}
+
+func Test_RunServer_ShutdownTimeout_ExpectError(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server, address := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- runServer(ctx, server, 50*time.Millisecond) }()
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			if res, err := http.Get("http://" + address); err == nil {
+				res.Body.Close()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	<-started
+	cancel()
+
+	assert.ErrorIs(t, <-result, context.DeadlineExceeded)
+}
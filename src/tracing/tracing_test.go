@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"backend-sample/common"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_End_RecordsBackendError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	End(child, common.NewBackendError(500, "CreateUser.2", "could not insert user", nil))
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Contains(t, spans[0].Attributes(), attribute.String("error.identifier", "CreateUser.2"))
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+func Test_RecordBackendError_ClientError_KeepsStatus(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, span := Start(context.Background(), "span")
+	End(span, common.NewBackendError(404, "GetUserById.3", "user not found for id %s", nil, "id"))
+
+	spans := recorder.Ended()
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Len(t, spans[0].Events(), 1)
+}
+
+func Test_Setup_FileExporter_WritesSpans(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), TracingConfiguration{Exporter: "file", File: file, SampleRatio: 1})
+	assert.NoError(t, err)
+
+	_, span := Start(context.Background(), "exported")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"Name":"exported"`)
+}
+
+func Test_Setup_InvalidExporter_ExpectError(t *testing.T) {
+	_, err := Setup(context.Background(), TracingConfiguration{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
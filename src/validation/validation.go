@@ -0,0 +1,235 @@
+package validation
+
+import (
+	"backend-sample/common"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// TagName is the struct tag holding the comma separated rules of a field, e.g. `validate:"required,max=100"`.
+// The regex rule takes the rest of the tag as its pattern, so it must come last.
+const TagName = "validate"
+
+// Rule reports whether value satisfies the rule given its parameter, the text after '=' in the tag.
+type Rule func(value reflect.Value, param string) bool
+
+type ruleDefinition struct {
+	rule    Rule
+	message string
+}
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]ruleDefinition{
+		"required": {required, "is required"},
+		"min":      {minRunes, "must have at least %s characters"},
+		"max":      {maxRunes, "must have at most %s characters"},
+		"email":    {email, "must be a valid email address"},
+		"uuid":     {uuidRule, "must be a UUID"},
+		"regex":    {regex, "must match %s"},
+	}
+
+	fieldsCache sync.Map // reflect.Type -> []field
+	regexCache  sync.Map // string -> *regexp.Regexp
+)
+
+// RegisterRule adds a custom rule usable in tags. message is the English message of its violations,
+// formatted with the rule parameter.
+func RegisterRule(name, message string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules[name] = ruleDefinition{rule: rule, message: message}
+}
+
+type field struct {
+	index     []int
+	name      string
+	omitEmpty bool
+	checks    []check
+}
+
+type check struct {
+	name  string
+	param string
+}
+
+// Validate checks every field of the struct v points to, or is, and returns all the violations.
+func Validate(v any) []common.Violation {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: %T is not a struct", v))
+	}
+
+	violations := make([]common.Violation, 0)
+	for _, field := range fieldsOf(value.Type()) {
+		fieldValue := value.FieldByIndex(field.index)
+		if field.omitEmpty && isEmpty(fieldValue) {
+			continue
+		}
+
+		for _, check := range field.checks {
+			rulesMu.RLock()
+			definition := rules[check.name]
+			rulesMu.RUnlock()
+
+			if !definition.rule(fieldValue, check.param) {
+				violations = append(violations, common.Violation{
+					Field:   field.name,
+					Rule:    check.name,
+					Param:   check.param,
+					Message: messageOf(definition.message, check.param),
+				})
+				// The other rules of a missing value would only repeat it.
+				if check.name == "required" {
+					break
+				}
+			}
+		}
+	}
+
+	return violations
+}
+
+// NewViolation returns the violation of the rule on field, for the checks a tag cannot express.
+func NewViolation(field, rule, param string) common.Violation {
+	rulesMu.RLock()
+	definition := rules[rule]
+	rulesMu.RUnlock()
+
+	return common.Violation{Field: field, Rule: rule, Param: param, Message: messageOf(definition.message, param)}
+}
+
+func messageOf(message, param string) string {
+	if strings.Contains(message, "%") {
+		return fmt.Sprintf(message, param)
+	}
+	return message
+}
+
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	fields := parseFields(t, nil, "")
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+func parseFields(t reflect.Type, index []int, prefix string) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+
+		name := prefix + jsonName(structField)
+		fieldIndex := append(append([]int(nil), index...), i)
+		if structField.Type.Kind() == reflect.Struct && structField.Tag.Get(TagName) == "" {
+			fields = append(fields, parseFields(structField.Type, fieldIndex, name+".")...)
+			continue
+		}
+
+		tag := structField.Tag.Get(TagName)
+		if tag == "" || tag == "-" {
+			continue
+		}
+		fields = append(fields, parseTag(t, structField, fieldIndex, name, tag))
+	}
+	return fields
+}
+
+func parseTag(t reflect.Type, structField reflect.StructField, index []int, name, tag string) field {
+	parsed := field{index: index, name: name}
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+
+		ruleName, param, _ := strings.Cut(part, "=")
+		if ruleName == "omitempty" {
+			parsed.omitEmpty = true
+			continue
+		}
+
+		rulesMu.RLock()
+		_, ok := rules[ruleName]
+		rulesMu.RUnlock()
+		if !ok {
+			panic(fmt.Sprintf("validation: unknown rule %q on %s.%s", ruleName, t.Name(), structField.Name))
+		}
+		parsed.checks = append(parsed.checks, check{name: ruleName, param: param})
+	}
+	return parsed
+}
+
+func jsonName(structField reflect.StructField) string {
+	name, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return structField.Name
+	}
+	return name
+}
+
+func isEmpty(value reflect.Value) bool {
+	if value.Kind() == reflect.String {
+		return strings.TrimSpace(value.String()) == ""
+	}
+	return value.IsZero()
+}
+
+func required(value reflect.Value, _ string) bool {
+	return !isEmpty(value)
+}
+
+func minRunes(value reflect.Value, param string) bool {
+	limit, err := strconv.Atoi(param)
+	return err == nil && length(value) >= limit
+}
+
+func maxRunes(value reflect.Value, param string) bool {
+	limit, err := strconv.Atoi(param)
+	return err == nil && length(value) <= limit
+}
+
+// length counts the characters of strings, not their bytes, and the items of collections.
+func length(value reflect.Value) int {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String())
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return value.Len()
+	default:
+		return 0
+	}
+}
+
+func email(value reflect.Value, _ string) bool {
+	return value.Kind() == reflect.String && common.IsValidEmail(value.String())
+}
+
+func uuidRule(value reflect.Value, _ string) bool {
+	return value.Kind() == reflect.String && common.IsValidUuid(value.String())
+}
+
+func regex(value reflect.Value, pattern string) bool {
+	compiled, ok := regexCache.Load(pattern)
+	if !ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false
+		}
+		compiled, _ = regexCache.LoadOrStore(pattern, re)
+	}
+	return value.Kind() == reflect.String && compiled.(*regexp.Regexp).MatchString(value.String())
+}
@@ -0,0 +1,71 @@
+package validation
+
+import (
+	"backend-sample/common"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRequest struct {
+	Name     string `json:"name" validate:"required,min=2,max=5"`
+	Email    string `json:"email" validate:"required,email"`
+	Id       string `json:"id,omitempty" validate:"omitempty,uuid"`
+	Code     string `json:"code" validate:"omitempty,regex=^[a-z]{2,3}$"`
+	Ignored  string `json:"ignored"`
+	internal string `validate:"required"`
+}
+
+func Test_Validate_ValidRequest_ExpectNoViolations(t *testing.T) {
+	violations := Validate(testRequest{Name: "José", Email: "jose@example.com", Code: "ab"})
+
+	assert.Empty(t, violations)
+}
+
+func Test_Validate_InvalidRequest_ExpectEveryViolation(t *testing.T) {
+	violations := Validate(&testRequest{Name: "J", Email: " ", Id: "42", Code: "a,b"})
+
+	assert.Equal(t, []common.Violation{
+		{Field: "name", Rule: "min", Param: "2", Message: "must have at least 2 characters"},
+		{Field: "email", Rule: "required", Message: "is required"},
+		{Field: "id", Rule: "uuid", Message: "must be a UUID"},
+		{Field: "code", Rule: "regex", Param: "^[a-z]{2,3}$", Message: "must match ^[a-z]{2,3}$"},
+	}, violations)
+}
+
+func Test_Validate_Max_CountsCharacters(t *testing.T) {
+	violations := Validate(testRequest{Name: "ãéíõú", Email: "a@example.com"})
+	assert.Empty(t, violations)
+
+	violations = Validate(testRequest{Name: "ãéíõúç", Email: "a@example.com"})
+	assert.Len(t, violations, 1)
+	assert.Equal(t, "max", violations[0].Rule)
+}
+
+func Test_RegisterRule_ExpectCustomRuleApplied(t *testing.T) {
+	RegisterRule("lowercase", "must be lowercase", func(value reflect.Value, _ string) bool {
+		return value.String() == strings.ToLower(value.String())
+	})
+	type request struct {
+		Login string `json:"login" validate:"lowercase"`
+	}
+
+	violations := Validate(request{Login: "Admin"})
+
+	assert.Equal(t, []common.Violation{{Field: "login", Rule: "lowercase", Message: "must be lowercase"}}, violations)
+}
+
+func Test_Validate_UnknownRule_ExpectPanic(t *testing.T) {
+	type request struct {
+		Name string `validate:"unknown"`
+	}
+
+	assert.Panics(t, func() { Validate(request{}) })
+}
+
+func Test_NewViolation_ExpectRuleMessage(t *testing.T) {
+	assert.Equal(t, common.Violation{Field: "id", Rule: "required", Message: "is required"}, NewViolation("id", "required", ""))
+	assert.Equal(t, "must have at most 5 characters", NewViolation("name", "max", "5").Message)
+}
@@ -3,6 +3,12 @@ package workflows
 import (
 	"backend-sample/common"
 	"backend-sample/database"
+	"backend-sample/metrics"
+	"backend-sample/tracing"
+	"backend-sample/validation"
+	"context"
+	"iter"
+	"log/slog"
 
 	"github.com/google/uuid"
 )
@@ -12,17 +18,19 @@ type UserWorkflowService struct {
 }
 
 type UsersWorkflow interface {
-	Create(UserRequest UserRequest) (*UserResponse, bool)
-	Update(UserRequest UserRequest) (*UserResponse, bool)
-	Delete(id string) bool
-	GetUsers(id, name string) *[]UserResponse
+	Create(ctx context.Context, req UserRequest) (*UserResponse, *common.BackendError)
+	Update(ctx context.Context, req UserRequest) (*UserResponse, *common.BackendError)
+	Delete(ctx context.Context, id string) *common.BackendError
+	GetUsers(ctx context.Context, id string) (*[]UserResponse, *common.BackendError)
+	StreamUsers(ctx context.Context, name string) (iter.Seq2[UserResponse, error], *common.BackendError)
 }
 
 type UserRequest struct {
-	Id       string `json:id`
-	Name     string `json:name`
-	Email    string `json:email`
-	Password string `json:password`
+	// Id is set from the path on updates and ignored on creation.
+	Id       string `json:"id" validate:"omitempty,uuid"`
+	Name     string `json:"name" validate:"required,max=100"`
+	Email    string `json:"email" validate:"required,max=100,email"`
+	Password string `json:"password" validate:"required,max=100"`
 }
 
 type UserResponse struct {
@@ -34,109 +42,103 @@ func NewUserWorkflow(repository database.UsersRepository) *UserWorkflowService {
 	return &UserWorkflowService{repository: repository}
 }
 
-func (w *UserWorkflowService) Create(req UserRequest) (*UserResponse, *common.BackendError) {
-	if !common.StringMinMaxLength(req.Email, 1, 100) {
-		return nil, common.NewBackendError(400, "Workflows.CreateUser.1", "invalid name", nil)
-	}
-	if !common.IsValidEmail(req.Email) {
-		return nil, common.NewBackendError(400, "Workflows.CreateUser.2", "invalid email", nil)
-	}
-	if !common.StringMinMaxLength(req.Name, 1, 100) {
-		return nil, common.NewBackendError(400, "Workflows.CreateUser.3", "invalid name", nil)
-	}
-	if !common.StringMinMaxLength(req.Password, 1, 100) {
-		return nil, common.NewBackendError(400, "Workflows.CreateUser.4", "invalid password", nil)
+func (w *UserWorkflowService) Create(ctx context.Context, req UserRequest) (_ *UserResponse, berr *common.BackendError) {
+	defer metrics.ObserveDuration(metrics.WorkflowDuration, "Create")()
+	ctx, span := tracing.Start(ctx, "UserWorkflowService.Create")
+	defer func() { tracing.End(span, berr) }()
+
+	if err := validateCreateRequest(ctx, req); err != nil {
+		return nil, err
 	}
 
-	user, err := w.repository.CreateUser(req.Name, req.Email, req.Password)
+	user, err := w.repository.CreateUser(ctx, req.Name, req.Email, req.Password)
 
 	if err != nil {
 		return nil, err
 	}
 
+	slog.InfoContext(ctx, "user created", "user_id", user.Id)
+
 	return &UserResponse{Id: user.Id, Name: user.Name, Email: user.Email, Password: user.Password}, nil
 }
 
-func (w *UserWorkflowService) Update(req UserRequest) (*UserResponse, *common.BackendError) {
-	if !common.IsValidUuid(req.Id) {
-		return nil, common.NewBackendError(400, "Workflows.UpdateUser.1", "invalid name", nil)
+func (w *UserWorkflowService) Update(ctx context.Context, req UserRequest) (_ *UserResponse, berr *common.BackendError) {
+	defer metrics.ObserveDuration(metrics.WorkflowDuration, "Update")()
+	ctx, span := tracing.Start(ctx, "UserWorkflowService.Update")
+	defer func() { tracing.End(span, berr) }()
+
+	if err := validateUpdateRequest(ctx, req); err != nil {
+		return nil, err
 	}
 	uuid := uuid.MustParse(req.Id)
-	user, err := w.repository.GetUserById(uuid)
+	user, err := w.repository.GetUserById(ctx, uuid)
 	if err != nil {
 		return nil, err
 	}
 	if user == nil {
 		return nil, nil
 	}
-	if !common.StringMinMaxLength(req.Email, 1, 100) {
-		return nil, common.NewBackendError(400, "Workflows.UpdateUser.3", "invalid name", nil)
-	}
-	if !common.IsValidEmail(req.Email) {
-		return nil, common.NewBackendError(400, "Workflows.UpdateUser.4", "invalid email", nil)
-	}
-	if !common.StringMinMaxLength(req.Name, 1, 100) {
-		return nil, common.NewBackendError(400, "Workflows.UpdateUser.5", "invalid name", nil)
-	}
-	if !common.StringMinMaxLength(req.Password, 1, 100) {
-		return nil, common.NewBackendError(400, "Workflows.UpdateUser.6", "invalid password", nil)
-	}
 
 	user.Email = req.Email
 	user.Name = req.Name
 	user.Password = req.Password
-	err = w.repository.UpdateUser(*user)
+	err = w.repository.UpdateUser(ctx, *user)
 
 	if err != nil {
 		return nil, err
 	}
 
+	slog.InfoContext(ctx, "user updated", "user_id", user.Id)
+
 	return &UserResponse{Id: user.Id, Name: user.Name, Email: user.Email, Password: user.Password}, nil
 }
 
-func (w *UserWorkflowService) Delete(id string) *common.BackendError {
-	if common.IsValidUuid(id) {
+func (w *UserWorkflowService) Delete(ctx context.Context, id string) (berr *common.BackendError) {
+	defer metrics.ObserveDuration(metrics.WorkflowDuration, "Delete")()
+	ctx, span := tracing.Start(ctx, "UserWorkflowService.Delete")
+	defer func() { tracing.End(span, berr) }()
+
+	if !common.IsValidUuid(id) {
 		return common.NewBackendError(400, "Workflows.DeleteUser.1", "invalid uuid", nil)
 	}
 	value := uuid.MustParse(id)
 
-	err := w.repository.DeleteUser(value)
+	err := w.repository.DeleteUser(ctx, value)
 
 	if err != nil {
 		return err
 	}
 
+	slog.InfoContext(ctx, "user deleted", "user_id", value)
+
 	return nil
 }
 
-func (w *UserWorkflowService) GetUsers(id, name string) (*[]UserResponse, *common.BackendError) {
+// GetUsers returns the user of id, searches by name are streamed by StreamUsers.
+func (w *UserWorkflowService) GetUsers(ctx context.Context, id string) (_ *[]UserResponse, berr *common.BackendError) {
+	defer metrics.ObserveDuration(metrics.WorkflowDuration, "GetUsers")()
+	ctx, span := tracing.Start(ctx, "UserWorkflowService.GetUsers")
+	defer func() { tracing.End(span, berr) }()
+
 	if id != "" && len(id) > 0 {
-		user, err := w.getUserById(id)
+		user, err := w.getUserById(ctx, id)
 		if err != nil {
 			return nil, err
 		}
 		return &[]UserResponse{*user}, nil
 	}
 
-	if name != "" && len(name) > 0 {
-		users, err := w.getUserByName(name)
-		if err != nil {
-			return nil, err
-		}
-		return users, nil
-	}
-
 	return nil, nil
 }
 
-func (w *UserWorkflowService) getUserById(id string) (*UserResponse, *common.BackendError) {
+func (w *UserWorkflowService) getUserById(ctx context.Context, id string) (*UserResponse, *common.BackendError) {
 	if !common.IsValidUuid(id) {
 		return nil, common.NewBackendError(400, "Workflows.getUserById.1", "invalid id %s", nil, id)
 	}
 
 	uuid := uuid.MustParse(id)
 
-	user, err := w.repository.GetUserById(uuid)
+	user, err := w.repository.GetUserById(ctx, uuid)
 
 	if err != nil {
 		return nil, err
@@ -145,28 +147,58 @@ func (w *UserWorkflowService) getUserById(id string) (*UserResponse, *common.Bac
 	return parseEntityToResponse(*user), nil
 }
 
-func (w *UserWorkflowService) getUserByName(name string) (*[]UserResponse, *common.BackendError) {
-	if !common.StringMinMaxLength(name, 1, 100) {
-		return nil, common.NewBackendError(400, "Workflows.getUserByName.1", "invalid name", nil)
+// StreamUsers validates name and returns the users named like it, or every user when it is empty,
+// to be written one by one. Nothing is queried before the sequence is iterated.
+func (w *UserWorkflowService) StreamUsers(ctx context.Context, name string) (iter.Seq2[UserResponse, error], *common.BackendError) {
+	if name != "" && !common.StringMinMaxLength(name, 1, 100) {
+		return nil, common.NewBackendError(400, "Workflows.StreamUsers.1", "invalid name", nil)
 	}
 
-	users, err := w.repository.GetUsersByName(name, false)
-
-	if err != nil {
-		return nil, err
+	users := w.repository.StreamUsers(ctx, database.UserWhereClause{})
+	if name != "" {
+		users = w.repository.StreamUsersByName(ctx, name, false)
 	}
 
-	return parseEntityListToResponse(*users), nil
+	return func(yield func(UserResponse, error) bool) {
+		for user, err := range users {
+			if err != nil {
+				yield(UserResponse{}, err)
+				return
+			}
+			if !yield(*parseEntityToResponse(user), nil) {
+				return
+			}
+		}
+	}, nil
 }
 
-func parseEntityToResponse(user database.UserEntity) *UserResponse {
-	return &UserResponse{Id: user.Id, Name: user.Name, Email: user.Email, Password: user.Password}
+func validateCreateRequest(ctx context.Context, req UserRequest) (berr *common.BackendError) {
+	_, span := tracing.Start(ctx, "UserWorkflowService.validateCreateRequest")
+	defer func() { tracing.End(span, berr) }()
+
+	if violations := validation.Validate(req); len(violations) > 0 {
+		return common.NewBackendError(422, "Workflows.CreateUser.5", "invalid user", nil).WithViolations(violations)
+	}
+
+	return nil
 }
 
-func parseEntityListToResponse(users []database.UserEntity) *[]UserResponse {
-	var response = make([]UserResponse, len(users))
-	for i, u := range users {
-		response[i] = *parseEntityToResponse(u)
+func validateUpdateRequest(ctx context.Context, req UserRequest) (berr *common.BackendError) {
+	_, span := tracing.Start(ctx, "UserWorkflowService.validateUpdateRequest")
+	defer func() { tracing.End(span, berr) }()
+
+	violations := validation.Validate(req)
+	// Optional on creation, the id is required to update.
+	if req.Id == "" {
+		violations = append([]common.Violation{validation.NewViolation("id", "required", "")}, violations...)
 	}
-	return &response
+	if len(violations) > 0 {
+		return common.NewBackendError(422, "Workflows.UpdateUser.7", "invalid user", nil).WithViolations(violations)
+	}
+
+	return nil
+}
+
+func parseEntityToResponse(user database.UserEntity) *UserResponse {
+	return &UserResponse{Id: user.Id, Name: user.Name, Email: user.Email, Password: user.Password}
 }
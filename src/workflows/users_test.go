@@ -0,0 +1,39 @@
+package workflows
+
+import (
+	"backend-sample/database"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// unusedRepository panics on any query, validation must reject the request before it reaches the repository.
+type unusedRepository struct {
+	database.UsersRepository
+}
+
+func Test_Update_InvalidIdAndFields_ExpectEveryViolation(t *testing.T) {
+	workflow := NewUserWorkflow(unusedRepository{})
+
+	_, berr := workflow.Update(context.Background(), UserRequest{Id: "42", Name: "", Email: "john", Password: ""})
+
+	assert.Equal(t, 422, berr.Code)
+	assert.Equal(t, "Workflows.UpdateUser.7", berr.Identifier)
+	fields := make([]string, 0, len(berr.Violations))
+	for _, violation := range berr.Violations {
+		fields = append(fields, violation.Field+":"+violation.Rule)
+	}
+	assert.Equal(t, []string{"id:uuid", "name:required", "email:email", "password:required"}, fields)
+}
+
+func Test_Update_NoId_ExpectRequiredViolation(t *testing.T) {
+	workflow := NewUserWorkflow(unusedRepository{})
+
+	_, berr := workflow.Update(context.Background(), UserRequest{Name: "John", Email: "john@example.com", Password: "secret"})
+
+	assert.Equal(t, 422, berr.Code)
+	assert.Len(t, berr.Violations, 1)
+	assert.Equal(t, "id", berr.Violations[0].Field)
+	assert.Equal(t, "required", berr.Violations[0].Rule)
+}